@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"favor-dao-backend/internal/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrCacheMiss is returned by DaoCache reads when the key simply isn't
+// cached, so the caller should fall through to Mongo.
+var ErrCacheMiss = errors.New("core: dao cache miss")
+
+// ErrCachedNotFound is returned by DaoCache reads when the key is
+// negatively cached - a prior lookup already established the DAO doesn't
+// exist, so the caller can skip Mongo entirely.
+var ErrCachedNotFound = errors.New("core: dao cached as not found")
+
+// DaoCache fronts the hot, read-heavy DAO lookups (GetDao, GetDaoFormatted,
+// GetDaoByName, GetMyDaoList, CheckSubscribeDAO, CheckJoinedDAO,
+// GetBlockDaoIDs) with a versioned cache. Every key for a DAO is scoped by
+// its current version, so UpdateDao/DeleteDao/SubDao can invalidate it
+// atomically by bumping the version rather than deleting each key.
+type DaoCache interface {
+	// GetDao returns the cached DAO, ErrCachedNotFound if negatively
+	// cached, or ErrCacheMiss if neither.
+	GetDao(ctx context.Context, daoID primitive.ObjectID) (*model.Dao, error)
+	SetDao(ctx context.Context, dao *model.Dao, ttl time.Duration) error
+	SetDaoNotFound(ctx context.Context, daoID primitive.ObjectID, ttl time.Duration) error
+
+	// GetDaoIDByName/SetDaoIDByName cache the name -> ID lookup GetDaoByName
+	// needs before it can defer to GetDao for the rest of the document.
+	GetDaoIDByName(ctx context.Context, name string) (primitive.ObjectID, error)
+	SetDaoIDByName(ctx context.Context, name string, daoID primitive.ObjectID, ttl time.Duration) error
+	// InvalidateDaoName clears a cached name -> ID mapping. UpdateDao calls
+	// this for a DAO's old name on rename, so the freed name can't keep
+	// resolving to the renamed-away DAO if another DAO claims it before the
+	// mapping's TTL would otherwise have expired it.
+	InvalidateDaoName(ctx context.Context, name string) error
+
+	GetDaoFormatted(ctx context.Context, user string, daoID primitive.ObjectID) (*model.DaoFormatted, error)
+	SetDaoFormatted(ctx context.Context, user string, daoID primitive.ObjectID, out *model.DaoFormatted, ttl time.Duration) error
+
+	// GetMyDaoList/SetMyDaoList are plain TTL entries, not versioned per
+	// DAO - the list spans every DAO an address owns, so bumping one
+	// DAO's version would require tracking membership back to here for
+	// little benefit. A short TTL bounds the staleness instead.
+	GetMyDaoList(ctx context.Context, address string) ([]*model.DaoFormatted, error)
+	SetMyDaoList(ctx context.Context, address string, list []*model.DaoFormatted, ttl time.Duration) error
+
+	// GetSubscribed/GetJoined report whether address is known to be
+	// subscribed to / joined in daoID. The bool return is only valid when
+	// err is nil; ErrCacheMiss means the caller must ask Mongo.
+	GetSubscribed(ctx context.Context, address string, daoID primitive.ObjectID) (bool, error)
+	SetSubscribed(ctx context.Context, address string, daoID primitive.ObjectID, subscribed bool, ttl time.Duration) error
+	GetJoined(ctx context.Context, address string, daoID primitive.ObjectID) (bool, error)
+	SetJoined(ctx context.Context, address string, daoID primitive.ObjectID, joined bool, ttl time.Duration) error
+
+	// GetBlockedDaoIDs/SetBlockedDaoIDs cache a user's blocked-DAO list;
+	// InvalidateBlockedList clears it after BlockDAO changes it.
+	GetBlockedDaoIDs(ctx context.Context, address string) ([]string, error)
+	SetBlockedDaoIDs(ctx context.Context, address string, ids []string, ttl time.Duration) error
+	InvalidateBlockedList(ctx context.Context, address string) error
+
+	// BumpVersion invalidates every DAO-scoped key cached for daoID -
+	// GetDao and GetDaoFormatted for every user - by moving them behind a
+	// version the next read will miss.
+	BumpVersion(ctx context.Context, daoID primitive.ObjectID) error
+	// InvalidateUser clears the subscribed/joined entries for
+	// (address, daoID), used after a subscription or membership change
+	// that shouldn't wait for those unversioned entries' TTL to expire.
+	InvalidateUser(ctx context.Context, address string, daoID primitive.ObjectID) error
+}
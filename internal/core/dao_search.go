@@ -0,0 +1,60 @@
+package core
+
+import "time"
+
+// DaoSearchQuery filters the DAO search index. Zero-value fields are not
+// applied, so querying with an empty DaoSearchQuery matches every indexed
+// DAO document, public or private.
+type DaoSearchQuery struct {
+	Keyword     string
+	Tags        []string
+	Visibility  []PostVisibleT
+	MinFollow   int64
+	MaxFollow   int64
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Offset      int
+	Limit       int
+}
+
+// DaoSearchHit is a single result row out of Query, carrying just enough
+// of the indexed document for list rendering; callers needing the full
+// DAO should look it up by ID.
+type DaoSearchHit struct {
+	DaoID       string
+	Score       float64
+	FollowCount int64
+	CreatedOn   int64
+}
+
+// DaoSearchResult is the page of hits Query returns, alongside the total
+// match count so callers can paginate.
+type DaoSearchResult struct {
+	Hits  []DaoSearchHit
+	Total int64
+}
+
+// DaoSuggestion is a single tag/name autocompletion candidate.
+type DaoSuggestion struct {
+	Text  string
+	Score float64
+}
+
+// DaoSearchService indexes and queries DAO documents. It is implemented
+// once per search backend (see pkg/search) so the backend can be swapped
+// without touching callers.
+type DaoSearchService interface {
+	// Index upserts each document in dao, replacing any previously indexed
+	// document for the same DAO ID.
+	Index(dao DocItems) (bool, error)
+	// Delete removes the documents for the given DAO IDs.
+	Delete(daoIDs []string) error
+	// Query runs q against the index and returns a page of hits.
+	Query(q DaoSearchQuery) (*DaoSearchResult, error)
+	// Reindex rebuilds the index from docs, typically used by a
+	// checkpointed background job rather than request handling.
+	Reindex(docs DocItems) (bool, error)
+	// Suggest returns autocompletion candidates for a partial tag/name
+	// prefix, most relevant first.
+	Suggest(prefix string, limit int) ([]DaoSuggestion, error)
+}
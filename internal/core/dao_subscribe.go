@@ -0,0 +1,7 @@
+package core
+
+import "errors"
+
+// ErrSubscriptionExpired is returned by SubDao when a subscribe order's
+// pay-wait deadline passes before its payment notification arrives.
+var ErrSubscriptionExpired = errors.New("core: subscribe order expired")
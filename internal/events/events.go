@@ -0,0 +1,68 @@
+// Package events provides an internal event bus for DAO lifecycle
+// side-effects (search indexing, chat sync, push notifications) so that
+// service code can publish what happened instead of calling each
+// downstream integration inline.
+package events
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Type identifies a kind of DAO lifecycle event.
+type Type string
+
+const (
+	DaoCreated    Type = "dao.created"
+	DaoUpdated    Type = "dao.updated"
+	DaoDeleted    Type = "dao.deleted"
+	DaoSubscribed Type = "dao.subscribed"
+	DaoBookmarked Type = "dao.bookmarked"
+)
+
+// Event is a single DAO lifecycle occurrence. It is persisted to the
+// outbox collection in the same transaction as the triggering mutation,
+// then handed to subscribers by the dispatcher.
+type Event struct {
+	ID      primitive.ObjectID     `bson:"_id,omitempty"`
+	Type    Type                   `bson:"type"`
+	DaoID   primitive.ObjectID     `bson:"dao_id"`
+	Address string                 `bson:"address"`
+	Payload map[string]interface{} `bson:"payload,omitempty"`
+}
+
+// Handler processes a published event. Returning an error causes the
+// dispatcher to retry the event with backoff.
+type Handler func(ctx context.Context, evt *Event) error
+
+// Bus fans events out to subscribers registered per Type. It does not
+// deliver events itself - Outbox.Stage only stages them in the outbox, and
+// the Dispatcher drains the outbox and invokes the matching handlers.
+type Bus struct {
+	subscribers map[Type][]Handler
+}
+
+// NewBus returns an empty Bus ready for subscribers to register on.
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[Type][]Handler)}
+}
+
+// Subscribe registers h to run whenever an event of type t is dispatched.
+// Handlers run in registration order; a failing handler does not stop
+// the others from running.
+func (b *Bus) Subscribe(t Type, h Handler) {
+	b.subscribers[t] = append(b.subscribers[t], h)
+}
+
+// dispatch invokes every handler registered for evt.Type, returning the
+// first error encountered (after running the remaining handlers).
+func (b *Bus) dispatch(ctx context.Context, evt *Event) error {
+	var firstErr error
+	for _, h := range b.subscribers[evt.Type] {
+		if err := h(ctx, evt); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
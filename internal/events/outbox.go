@@ -0,0 +1,161 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxStatus is the delivery state of a staged event.
+type outboxStatus int8
+
+const (
+	outboxPending outboxStatus = iota
+	outboxDispatched
+	outboxFailed
+)
+
+const outboxCollection = "event_outbox"
+
+// outboxDoc is the Mongo representation of a staged event, carrying the
+// retry bookkeeping the dispatcher needs on top of the Event itself.
+type outboxDoc struct {
+	Event     `bson:",inline"`
+	Status    outboxStatus `bson:"status"`
+	Attempts  int          `bson:"attempts"`
+	NextTryAt int64        `bson:"next_try_at"`
+	LastError string       `bson:"last_error,omitempty"`
+	CreatedOn int64        `bson:"created_on"`
+}
+
+// Outbox stages events in Mongo so a publish survives a crash between the
+// triggering mutation committing and the side-effects running, and drives
+// a background dispatcher that retries failed deliveries with backoff.
+type Outbox struct {
+	db  *mongo.Database
+	bus *Bus
+
+	// MaxAttempts bounds retries before an event is marked outboxFailed
+	// and left for manual inspection rather than retried forever.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry; each subsequent
+	// retry doubles it, capped at MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// NewOutbox returns an Outbox that stages events in db and dispatches
+// them to bus's subscribers.
+func NewOutbox(db *mongo.Database, bus *Bus) *Outbox {
+	return &Outbox{
+		db:          db,
+		bus:         bus,
+		MaxAttempts: 10,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+	}
+}
+
+// Stage writes evt to the outbox. Passing a mongo.SessionContext (as
+// produced inside a WithTransaction callback) lets the insert ride along
+// with the DAO mutation that produced the event, so the two either both
+// commit or both roll back; a plain context.Context stages it outside of
+// any transaction.
+func (o *Outbox) Stage(ctx context.Context, evt *Event) error {
+	if evt.ID.IsZero() {
+		evt.ID = primitive.NewObjectID()
+	}
+	doc := outboxDoc{
+		Event:     *evt,
+		Status:    outboxPending,
+		CreatedOn: time.Now().Unix(),
+	}
+	_, err := o.db.Collection(outboxCollection).InsertOne(ctx, doc)
+	return err
+}
+
+// Run polls the outbox for due events and dispatches them until ctx is
+// cancelled. It is intended to be started once, in its own goroutine, by
+// the process that owns the Mongo connection.
+func (o *Outbox) Run(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.drain(ctx)
+		}
+	}
+}
+
+func (o *Outbox) drain(ctx context.Context) {
+	col := o.db.Collection(outboxCollection)
+	now := time.Now().Unix()
+	cur, err := col.Find(ctx, bson.M{
+		"status":      outboxPending,
+		"next_try_at": bson.M{"$lte": now},
+	}, options.Find().SetSort(bson.M{"created_on": 1}).SetLimit(100))
+	if err != nil {
+		logrus.Errorf("events: outbox find err: %v", err)
+		return
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var doc outboxDoc
+		if err := cur.Decode(&doc); err != nil {
+			logrus.Errorf("events: outbox decode err: %v", err)
+			continue
+		}
+		o.deliver(ctx, col, doc)
+	}
+}
+
+func (o *Outbox) deliver(ctx context.Context, col *mongo.Collection, doc outboxDoc) {
+	err := o.bus.dispatch(ctx, &doc.Event)
+	if err == nil {
+		_, updErr := col.UpdateByID(ctx, doc.ID, bson.M{
+			"$set": bson.M{"status": outboxDispatched},
+		})
+		if updErr != nil {
+			logrus.Errorf("events: mark dispatched err: %v", updErr)
+		}
+		return
+	}
+
+	doc.Attempts++
+	update := bson.M{
+		"attempts":   doc.Attempts,
+		"last_error": err.Error(),
+	}
+	if doc.Attempts >= o.MaxAttempts {
+		update["status"] = outboxFailed
+		logrus.Errorf("events: giving up on %s after %d attempts: %v", doc.Type, doc.Attempts, err)
+	} else {
+		backoff := nextBackoff(o.BaseBackoff, o.MaxBackoff, doc.Attempts-1)
+		update["next_try_at"] = time.Now().Add(backoff).Unix()
+		logrus.Warnf("events: dispatch %s failed (attempt %d), retrying in %s: %v", doc.Type, doc.Attempts, backoff, err)
+	}
+	if _, updErr := col.UpdateByID(ctx, doc.ID, bson.M{"$set": update}); updErr != nil {
+		logrus.Errorf("events: update retry state err: %v", updErr)
+	}
+}
+
+// nextBackoff doubles base once per attempt, capped at max. It also
+// guards the overflow case: base<<attempts wraps negative once attempts
+// is large enough to shift the sign bit into place, which would
+// otherwise schedule the next retry in the past instead of capping it.
+func nextBackoff(base, max time.Duration, attempts int) time.Duration {
+	backoff := base << attempts
+	if backoff > max || backoff <= 0 {
+		return max
+	}
+	return backoff
+}
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	base := time.Second
+	max := time.Minute
+
+	cases := []struct {
+		name     string
+		attempts int
+		want     time.Duration
+	}{
+		{"first retry uses base", 0, time.Second},
+		{"doubles per attempt", 1, 2 * time.Second},
+		{"keeps doubling", 3, 8 * time.Second},
+		{"caps at max", 10, time.Minute},
+		{"overflow falls back to max", 100, time.Minute},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := nextBackoff(base, max, c.attempts)
+			if got != c.want {
+				t.Errorf("nextBackoff(%s, %s, %d) = %s, want %s", base, max, c.attempts, got, c.want)
+			}
+		})
+	}
+}
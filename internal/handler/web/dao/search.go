@@ -0,0 +1,69 @@
+package dao
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"favor-dao-backend/internal/core"
+	"favor-dao-backend/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// searchDaoReq binds the query params accepted by GET /dao/search.
+type searchDaoReq struct {
+	Keyword   string   `form:"keyword"`
+	Tags      []string `form:"tags"`
+	MinFollow int64    `form:"min_follow"`
+	MaxFollow int64    `form:"max_follow"`
+	From      int64    `form:"from"` // unix seconds
+	To        int64    `form:"to"`   // unix seconds
+	Offset    int      `form:"offset"`
+	Limit     int      `form:"limit"`
+}
+
+// SearchDao handles GET /dao/search, querying the configured DAO search
+// backend with the filters bound from searchDaoReq.
+func SearchDao(c *gin.Context) {
+	var req searchDaoReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	q := core.DaoSearchQuery{
+		Keyword:   req.Keyword,
+		Tags:      req.Tags,
+		MinFollow: req.MinFollow,
+		MaxFollow: req.MaxFollow,
+		Offset:    req.Offset,
+		Limit:     req.Limit,
+	}
+	if req.From > 0 {
+		q.CreatedFrom = time.Unix(req.From, 0)
+	}
+	if req.To > 0 {
+		q.CreatedTo = time.Unix(req.To, 0)
+	}
+
+	res, err := service.QueryDaoSearch(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// SuggestDao handles GET /dao/search/suggest, returning the search
+// backend's autocompletion candidates for the "q" query param.
+func SuggestDao(c *gin.Context) {
+	prefix := c.Query("q")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	suggestions, err := service.SuggestDaoNames(prefix, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
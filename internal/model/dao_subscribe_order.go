@@ -0,0 +1,203 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureDaoSubscribeOrderIndexes creates the indexes DaoSubscribeOrder
+// relies on. It must run once at startup, before any Create call: without
+// the unique index on idempotency_key, mongo.IsDuplicateKeyError in
+// Create never fires, and two concurrent/retried subscribe requests for
+// the same (address, dao, period) simply insert two separate orders
+// instead of colliding - silently defeating the idempotency key this
+// type exists for.
+//
+// The index is partial, covering only the in-flight states (Submitted,
+// Paid): once an order settles - activated, expired, refunded, or failed
+// - its idempotency key is released. Without the filter, a DAO that was
+// subscribed to once and later unsubscribed (or whose first attempt
+// expired/failed) could never be subscribed to again: every later
+// attempt would collide on the first attempt's now-terminal row forever.
+func EnsureDaoSubscribeOrderIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(daoSubscribeOrderCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.M{"idempotency_key": 1},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"state": bson.M{"$in": []SubscriptionState{SubscriptionSubmitted, SubscriptionPaid}},
+			}),
+		},
+		{
+			Keys: bson.M{"order_id": 1},
+		},
+		{
+			Keys: bson.M{"state": 1, "pay_deadline": 1},
+		},
+	})
+	return err
+}
+
+// SubscriptionState is a DaoSubscribeOrder's position in the subscription
+// payment state machine:
+//
+//	Submitted -> Paid -> Activated
+//	Submitted -> Expired (pay-wait deadline passed with no callback)
+//	Expired   -> Refunded (refund issued for an expired order that
+//	             already had a payment TxID recorded)
+//	Submitted -> Failed (payment initiation itself failed)
+type SubscriptionState int8
+
+const (
+	SubscriptionSubmitted SubscriptionState = iota
+	SubscriptionPaid
+	SubscriptionActivated
+	SubscriptionExpired
+	SubscriptionRefunded
+	SubscriptionFailed
+)
+
+// ErrDuplicateSubscribeOrder is returned by DaoSubscribeOrder.Create when
+// an order already exists for the same idempotency key, i.e. a client
+// retried a subscribe request that already went through.
+var ErrDuplicateSubscribeOrder = errors.New("model: duplicate dao subscribe order")
+
+// ErrInvalidSubscriptionTransition is returned by UpdateState when the
+// requested state isn't reachable from one of fromStates in the
+// Submitted -> Paid -> Activated | Expired -> Refunded | Submitted ->
+// Failed machine.
+var ErrInvalidSubscriptionTransition = errors.New("model: invalid subscription state transition")
+
+// subscriptionTransitions enumerates the legal state machine edges.
+var subscriptionTransitions = map[SubscriptionState]map[SubscriptionState]bool{
+	SubscriptionSubmitted: {SubscriptionPaid: true, SubscriptionExpired: true, SubscriptionFailed: true},
+	SubscriptionPaid:      {SubscriptionActivated: true},
+	SubscriptionExpired:   {SubscriptionRefunded: true},
+}
+
+// validSubscriptionTransition reports whether to is reachable from from
+// in one step of the subscription state machine. from == to is always
+// valid: it's used to record metadata (e.g. a newly-known txID) without
+// moving the order to a new state.
+func validSubscriptionTransition(from, to SubscriptionState) bool {
+	return from == to || subscriptionTransitions[from][to]
+}
+
+const daoSubscribeOrderCollection = "dao_subscribe_order"
+
+// DaoSubscribeOrder is the state-machine record for one subscribe
+// attempt. It is keyed by IdempotencyKey (a hash of address+daoID+period)
+// so a client retrying the same subscribe request after a dropped
+// response reuses the original order instead of double-charging.
+type DaoSubscribeOrder struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	OrderID        string             `bson:"order_id"`
+	IdempotencyKey string             `bson:"idempotency_key"`
+	Address        string             `bson:"address"`
+	DaoID          primitive.ObjectID `bson:"dao_id"`
+	Period         string             `bson:"period"`
+	TxID           string             `bson:"tx_id"`
+	Price          string             `bson:"price"`
+	State          SubscriptionState  `bson:"state"`
+	PayDeadline    int64              `bson:"pay_deadline"`
+	CreatedOn      int64              `bson:"created_on"`
+	ModifiedOn     int64              `bson:"modified_on"`
+}
+
+// DaoSubscribeIdempotencyKey derives the idempotency key for a
+// (address, daoID, period) subscribe request: the same triple always
+// hashes to the same key, so retries of the same request collide on the
+// unique index instead of creating a second order.
+func DaoSubscribeIdempotencyKey(address string, daoID primitive.ObjectID, period string) string {
+	sum := sha256.Sum256([]byte(address + ":" + daoID.Hex() + ":" + period))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create inserts o, returning ErrDuplicateSubscribeOrder if an order
+// already exists for o.IdempotencyKey (the collection must have a unique
+// index on idempotency_key for this to be race-free).
+func (o *DaoSubscribeOrder) Create(ctx context.Context, db *mongo.Database) error {
+	now := time.Now().Unix()
+	o.CreatedOn = now
+	o.ModifiedOn = now
+	if o.ID.IsZero() {
+		o.ID = primitive.NewObjectID()
+	}
+	_, err := db.Collection(daoSubscribeOrderCollection).InsertOne(ctx, o)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateSubscribeOrder
+	}
+	return err
+}
+
+// FindByIdempotencyKey loads the in-flight (Submitted or Paid) order for
+// key, if any; settled orders sharing the key are not matched.
+func (o *DaoSubscribeOrder) FindByIdempotencyKey(ctx context.Context, db *mongo.Database, key string) error {
+	return db.Collection(daoSubscribeOrderCollection).FindOne(ctx, bson.M{
+		"idempotency_key": key,
+		"state":           bson.M{"$in": []SubscriptionState{SubscriptionSubmitted, SubscriptionPaid}},
+	}).Decode(o)
+}
+
+// FindByOrderID loads the order with the given order ID.
+func (o *DaoSubscribeOrder) FindByOrderID(ctx context.Context, db *mongo.Database, orderID string) error {
+	return db.Collection(daoSubscribeOrderCollection).FindOne(ctx, bson.M{"order_id": orderID}).Decode(o)
+}
+
+// UpdateState transitions the order to state, setting txID when non-empty.
+// It only matches documents still in fromStates, so a concurrent
+// transition (e.g. the reconciler expiring an order the pay callback is
+// simultaneously activating) can't clobber the other's result.
+func (o *DaoSubscribeOrder) UpdateState(ctx context.Context, db *mongo.Database, state SubscriptionState, txID string, fromStates ...SubscriptionState) error {
+	for _, from := range fromStates {
+		if !validSubscriptionTransition(from, state) {
+			return ErrInvalidSubscriptionTransition
+		}
+	}
+	filter := bson.M{"order_id": o.OrderID}
+	if len(fromStates) > 0 {
+		filter["state"] = bson.M{"$in": fromStates}
+	}
+	update := bson.M{"state": state, "modified_on": time.Now().Unix()}
+	if txID != "" {
+		update["tx_id"] = txID
+	}
+	res, err := db.Collection(daoSubscribeOrderCollection).UpdateOne(ctx, filter, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	o.State = state
+	if txID != "" {
+		o.TxID = txID
+	}
+	return nil
+}
+
+// FindStuckSubmitted returns up to limit orders still Submitted whose
+// pay-wait deadline has passed, for the reconciler to poll and expire.
+func FindStuckSubmitted(ctx context.Context, db *mongo.Database, now time.Time, limit int64) ([]*DaoSubscribeOrder, error) {
+	cur, err := db.Collection(daoSubscribeOrderCollection).Find(ctx, bson.M{
+		"state":        SubscriptionSubmitted,
+		"pay_deadline": bson.M{"$lte": now.Unix()},
+	}, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var orders []*DaoSubscribeOrder
+	if err := cur.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidSubscriptionTransition(t *testing.T) {
+	cases := []struct {
+		name string
+		from SubscriptionState
+		to   SubscriptionState
+		want bool
+	}{
+		{"submitted to paid", SubscriptionSubmitted, SubscriptionPaid, true},
+		{"submitted to expired", SubscriptionSubmitted, SubscriptionExpired, true},
+		{"submitted to failed", SubscriptionSubmitted, SubscriptionFailed, true},
+		{"paid to activated", SubscriptionPaid, SubscriptionActivated, true},
+		{"expired to refunded", SubscriptionExpired, SubscriptionRefunded, true},
+		{"same state is a no-op update", SubscriptionSubmitted, SubscriptionSubmitted, true},
+		{"submitted cannot skip straight to activated", SubscriptionSubmitted, SubscriptionActivated, false},
+		{"activated is terminal", SubscriptionActivated, SubscriptionExpired, false},
+		{"refunded is terminal", SubscriptionRefunded, SubscriptionPaid, false},
+		{"failed is terminal", SubscriptionFailed, SubscriptionSubmitted, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := validSubscriptionTransition(c.from, c.to); got != c.want {
+				t.Errorf("validSubscriptionTransition(%v, %v) = %v, want %v", c.from, c.to, got, c.want)
+			}
+		})
+	}
+}
+
+func TestDaoSubscribeIdempotencyKey(t *testing.T) {
+	daoID := primitive.NewObjectID()
+	otherDaoID := primitive.NewObjectID()
+
+	key := DaoSubscribeIdempotencyKey("0xalice", daoID, "")
+	if key != DaoSubscribeIdempotencyKey("0xalice", daoID, "") {
+		t.Fatal("same (address, dao, period) must hash to the same key")
+	}
+	if key == DaoSubscribeIdempotencyKey("0xbob", daoID, "") {
+		t.Fatal("different address must hash to a different key")
+	}
+	if key == DaoSubscribeIdempotencyKey("0xalice", otherDaoID, "") {
+		t.Fatal("different dao must hash to a different key")
+	}
+	if key == DaoSubscribeIdempotencyKey("0xalice", daoID, "monthly") {
+		t.Fatal("different period must hash to a different key")
+	}
+}
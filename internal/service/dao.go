@@ -3,20 +3,16 @@ package service
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log"
-	"math"
 	"strings"
 	"time"
 
 	"favor-dao-backend/internal/conf"
 	"favor-dao-backend/internal/core"
+	"favor-dao-backend/internal/events"
 	"favor-dao-backend/internal/model"
 	"favor-dao-backend/pkg/convert"
 	"favor-dao-backend/pkg/errcode"
-	notify1 "favor-dao-backend/pkg/notify"
-	"favor-dao-backend/pkg/pointSystem"
-	"favor-dao-backend/pkg/psub"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
@@ -57,10 +53,7 @@ type DaoListReq struct {
 }
 
 func GetDaoByName(name string) (_ *model.Dao, err error) {
-	dao := &model.Dao{
-		Name: name,
-	}
-	return ds.GetDaoByName(dao)
+	return cachedGetDaoByName(context.Background(), name)
 }
 
 func CreateDao(_ *gin.Context, userAddress string, param DaoCreationReq, chatAction func(context.Context, *model.Dao) (string, error)) (_ *model.DaoFormatted, err error) {
@@ -84,7 +77,14 @@ func CreateDao(_ *gin.Context, userAddress string, param DaoCreationReq, chatAct
 			return nil, err
 		}
 	}
-	res, err := ds.CreateDao(dao, chatAction)
+	res, err := ds.CreateDao(dao, func(ctx context.Context, d *model.Dao) (string, error) {
+		gid, err := chatAction(ctx, d)
+		if err != nil {
+			return gid, err
+		}
+		stageDaoEvent(ctx, events.DaoCreated, d, nil)
+		return gid, nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -96,18 +96,22 @@ func CreateDao(_ *gin.Context, userAddress string, param DaoCreationReq, chatAct
 		}
 		ds.CreateTag(tag)
 	}
-	// push to search
-	_, err = PushDaoToSearch(dao)
-	if err != nil {
-		logrus.Warnf("%s when create, push dao to search err: %v", userAddress, err)
-	}
 
 	return res.Format(), nil
 }
 
 func DeleteDao(_ *gin.Context, daoId string) error {
 	id, _ := primitive.ObjectIDFromHex(daoId)
-	return ds.DeleteDao(&model.Dao{ID: id})
+	dao := &model.Dao{ID: id}
+	err := ds.DeleteDao(dao, func(ctx context.Context, d *model.Dao) error {
+		stageDaoEvent(ctx, events.DaoDeleted, d, nil)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bumpDaoCache(context.Background(), id)
+	return nil
 }
 
 func GetDaoBookmarkList(userAddress string, q *core.QueryReq, offset, limit int) (list []*model.DaoFormatted, total int64) {
@@ -151,6 +155,7 @@ func UpdateDao(userAddress string, param DaoUpdateReq) (e *errcode.Error) {
 	tags := tagsFrom(param.Tags)
 	change := false
 	changeChat := false
+	oldName := dao.Name
 	if len(tags) != 0 {
 		dao.Tags = strings.Join(tags, ",")
 		change = true
@@ -190,26 +195,21 @@ func UpdateDao(userAddress string, param DaoUpdateReq) (e *errcode.Error) {
 		return errcode.DAONothingChange
 	}
 	err = ds.UpdateDao(dao, func(ctx context.Context, dao *model.Dao) error {
-		if changeChat {
-			err = UpdateChatGroup(ctx, dao.Address, dao.ID.Hex(), dao.Name, dao.Avatar, dao.Introduction)
-			if err != nil {
-				logrus.Warnf("%s UpdateChatGroup err: %v", userAddress, err)
-				e = errcode.UpdateChatGroupFailed
-			}
-			return err
-		}
+		payload := map[string]interface{}{"changed_chat": changeChat}
+		stageDaoEvent(ctx, events.DaoUpdated, dao, payload)
 		return nil
 	})
 	if err != nil {
 		if errors.Is(err, model.ErrDuplicateDAOName) {
 			return errcode.DaoNameDuplication
 		}
-		if e != nil {
-			return e
-		}
 		logrus.Warnf("%s UpdateDao err: %v", userAddress, err)
 		return errcode.UpdateDaoFailed
 	}
+	bumpDaoCache(context.Background(), dao.ID)
+	if dao.Name != oldName {
+		invalidateDaoNameCache(context.Background(), oldName)
+	}
 	for _, t := range tags {
 		tag := &model.Tag{
 			Address: userAddress,
@@ -217,12 +217,6 @@ func UpdateDao(userAddress string, param DaoUpdateReq) (e *errcode.Error) {
 		}
 		ds.CreateTag(tag)
 	}
-	// push to search
-	_, err = PushDaoToSearch(dao)
-	if err != nil {
-		logrus.Warnf("%s when update, push dao to search err: %v", userAddress, err)
-		return errcode.ServerError.WithDetails(err.Error())
-	}
 	return nil
 }
 
@@ -231,35 +225,43 @@ func GetDao(daoId string) (*core.Dao, error) {
 	if err != nil {
 		return nil, err
 	}
-	dao := &model.Dao{
-		ID: id,
-	}
-	return ds.GetDao(dao)
+	return cachedGetDao(context.Background(), id)
 }
 
 func GetDaoFormatted(user, daoId string) (*model.DaoFormatted, error) {
+	// Coalesce concurrent callers asking about the same (user, daoId) so a
+	// spike of requests for one DAO only does the underlying lookups once.
+	v, err, _ := daoFormattedGroup.Do(user+":"+daoId, func() (interface{}, error) {
+		return getDaoFormatted(user, daoId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*model.DaoFormatted), nil
+}
+
+func getDaoFormatted(user, daoId string) (*model.DaoFormatted, error) {
+	ctx := context.Background()
 	var (
 		dao *model.Dao
 		res *model.Dao
 	)
 	id, err := primitive.ObjectIDFromHex(daoId)
 	if err != nil {
-		var getErr error
-		dao = &model.Dao{Name: daoId}
-		res, getErr = ds.GetDaoByName(dao)
-		if getErr != nil {
-			if errors.Is(getErr, mongo.ErrNoDocuments) {
-				return nil, err
-			}
-			err = getErr
+		res, err = cachedGetDaoByName(ctx, daoId)
+		if err != nil {
+			return nil, err
 		}
-		err = nil
 		id = res.ID
+		dao = res
 	} else {
-		dao = &model.Dao{
-			ID: id,
+		if daoCache != nil {
+			if cached, cerr := daoCache.GetDaoFormatted(ctx, user, id); cerr == nil {
+				return cached, nil
+			}
 		}
-		res, err = ds.GetDao(dao)
+		res, err = cachedGetDao(ctx, id)
+		dao = res
 	}
 	if err != nil {
 		return nil, err
@@ -269,8 +271,8 @@ func GetDaoFormatted(user, daoId string) (*model.DaoFormatted, error) {
 		out.IsJoined = true
 		out.IsSubscribed = true
 	} else {
-		out.IsJoined = CheckJoinedDAO(user, id)
-		out.IsSubscribed = CheckSubscribeDAO(user, id)
+		out.IsJoined = cachedCheckJoinedDAO(ctx, user, id)
+		out.IsSubscribed = cachedCheckSubscribeDAO(ctx, user, id)
 	}
 
 	out.LastPosts = []*model.PostFormatted{}
@@ -302,14 +304,32 @@ func GetDaoFormatted(user, daoId string) (*model.DaoFormatted, error) {
 		Limit:      1,
 	})
 	out.LastPosts = append(out.LastPosts, resp2...)
+
+	if daoCache != nil {
+		if e := daoCache.SetDaoFormatted(ctx, user, id, out, daoFormattedCacheTTL); e != nil {
+			logrus.Warnf("service: dao formatted cache write err: %v", e)
+		}
+	}
 	return out, nil
 }
 
 func GetMyDaoList(address string) ([]*model.DaoFormatted, error) {
-	dao := &model.Dao{
-		Address: address,
+	ctx := context.Background()
+	if daoCache != nil {
+		if list, err := daoCache.GetMyDaoList(ctx, address); err == nil {
+			return list, nil
+		}
+	}
+	list, err := ds.GetMyDaoList(&model.Dao{Address: address})
+	if err != nil {
+		return nil, err
+	}
+	if daoCache != nil {
+		if e := daoCache.SetMyDaoList(ctx, address, list, daoMyListCacheTTL); e != nil {
+			logrus.Warnf("service: dao my-list cache write err: %v", e)
+		}
 	}
-	return ds.GetMyDaoList(dao)
+	return list, nil
 }
 
 func GetDaoBookmark(userAddress string, daoId string) (*model.DaoBookmark, error) {
@@ -317,14 +337,33 @@ func GetDaoBookmark(userAddress string, daoId string) (*model.DaoBookmark, error
 }
 
 func CreateDaoBookmark(myAddress string, daoId string, chatAction func(context.Context, *model.Dao) (gid string, e error)) (*model.DaoBookmark, error) {
-	return ds.CreateDaoFollow(myAddress, daoId, chatAction)
+	return ds.CreateDaoFollow(myAddress, daoId, func(ctx context.Context, dao *model.Dao) (string, error) {
+		gid, err := chatAction(ctx, dao)
+		if err != nil {
+			return gid, err
+		}
+		stageDaoEvent(ctx, events.DaoBookmarked, dao, map[string]interface{}{"followed": true})
+		invalidateUserDaoCache(ctx, myAddress, dao.ID)
+		return gid, nil
+	})
 }
 
 func DeleteDaoBookmark(book *model.DaoBookmark, chatAction func(context.Context, *model.Dao) (string, error)) error {
-	return ds.DeleteDaoFollow(book, chatAction)
+	return ds.DeleteDaoFollow(book, func(ctx context.Context, dao *model.Dao) (string, error) {
+		gid, err := chatAction(ctx, dao)
+		if err != nil {
+			return gid, err
+		}
+		stageDaoEvent(ctx, events.DaoBookmarked, dao, map[string]interface{}{"followed": false})
+		invalidateUserDaoCache(ctx, book.Address, dao.ID)
+		return gid, nil
+	})
 }
 
-func PushDaoToSearch(dao *model.Dao) (bool, error) {
+// daoSearchDoc builds the search document for dao, shared by
+// PushDaoToSearch (one DAO) and batch callers that index many DAOs in a
+// single Index call.
+func daoSearchDoc(dao *model.Dao) map[string]interface{} {
 	contentFormatted := dao.Name + "\n"
 	contentFormatted += dao.Introduction + "\n"
 
@@ -340,7 +379,7 @@ func PushDaoToSearch(dao *model.Dao) (bool, error) {
 		visibility = core.PostVisitPublic
 	}
 
-	data := core.DocItems{{
+	return map[string]interface{}{
 		"id":                dao.ID,
 		"address":           dao.Address,
 		"dao_id":            dao.ID.Hex(),
@@ -359,37 +398,22 @@ func PushDaoToSearch(dao *model.Dao) (bool, error) {
 		"created_on":        dao.CreatedOn,
 		"modified_on":       dao.ModifiedOn,
 		"latest_replied_on": time.Now().Unix(),
-	}}
+	}
+}
 
-	return ts.AddDocuments(data, dao.ID.Hex())
+func PushDaoToSearch(dao *model.Dao) (bool, error) {
+	return daoSearch.Index(core.DocItems{daoSearchDoc(dao)})
 }
 
 func DeleteSearchDao(post *model.Dao) error {
-	return ts.DeleteDocuments([]string{post.ID.Hex()})
+	return daoSearch.Delete([]string{post.ID.Hex()})
 }
 
+// PushDAOsToSearch rebuilds the DAO search index as a resumable,
+// checkpointed job; see ReindexDaos.
 func PushDAOsToSearch() {
-	splitNum := 1000
-	totalRows, _ := GetDaoCount(nil)
-
-	pages := math.Ceil(float64(totalRows) / float64(splitNum))
-	nums := int(pages)
-
-	for i := 0; i < nums; i++ {
-		posts, _ := GetDaoList(&DaoListReq{
-			Conditions: model.ConditionsT{},
-			Offset:     i * splitNum,
-			Limit:      splitNum,
-		})
-
-		for _, dao := range posts {
-			_, err := PushDaoToSearch(dao)
-			if err != nil {
-				log.Printf("dao: add document err: %s\n", err)
-				continue
-			}
-			log.Printf("dao: add document success, dao_id: %s\n", dao.ID.Hex())
-		}
+	if err := ReindexDaos(context.Background(), 1000, 4); err != nil {
+		log.Printf("dao: reindex err: %s\n", err)
 	}
 }
 
@@ -414,11 +438,11 @@ func CheckIsMyDAO(address string, daoID primitive.ObjectID) *errcode.Error {
 }
 
 func CheckSubscribeDAO(address string, daoID primitive.ObjectID) bool {
-	return ds.IsSubscribeDAO(address, daoID)
+	return cachedCheckSubscribeDAO(context.Background(), address, daoID)
 }
 
 func CheckJoinedDAO(address string, daoID primitive.ObjectID) bool {
-	return ds.IsJoinedDAO(address, daoID)
+	return cachedCheckJoinedDAO(context.Background(), address, daoID)
 }
 
 func CheckDAOUser(daoID primitive.ObjectID) *errcode.Error {
@@ -433,145 +457,19 @@ func CheckDAOUser(daoID primitive.ObjectID) *errcode.Error {
 	return nil
 }
 
-func SubDao(ctx context.Context, daoID primitive.ObjectID, address string) (txID string, status core.DaoSubscribeT, err error) {
-	var (
-		oid    string
-		notify *psub.Notify
-	)
-	defer func() {
-		if notify != nil {
-			notify.Cancel()
-		}
-	}()
-
-	var toAddress string
-	var price float64
-
-	// check old subscribe
-	sub := model.DaoSubscribe{}
-	err = sub.FindOne(ctx, conf.MustMongoDB(), bson.M{"address": address, "dao_id": daoID})
-	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
-		return
-	}
-	if err != nil {
-		// ErrNoDocuments
-		// create order
-		err = ds.SubscribeDAO(address, daoID, func(ctx context.Context, orderID string, dao *model.Dao) error {
-			oid = orderID
-			// sub order
-			notify, err = pubsub.NewSubscribe(orderID)
-			if err != nil {
-				return err
-			}
-			toAddress = dao.Address
-			price = convert.StrTo(dao.Price).MustFloat64() / 1000
-			// pay
-			txID, err = point.Pay(ctx, pointSystem.PayRequest{
-				FromObject: address,
-				ToSubject:  toAddress,
-				Amount:     dao.Price,
-				Comment:    "",
-				Channel:    "sub_dao",
-				ReturnURI:  conf.PointSetting.Callback + "/pay/notify?method=sub_dao&order_id=" + orderID,
-				BindOrder:  orderID,
-			})
-			return err
-		})
-		if err != nil {
-			return
-		}
-		e := ds.UpdateSubscribeDAOTxID(oid, txID)
-		if e != nil {
-			logrus.Errorf("ds.UpdateSubscribeDAOTxID order_id:%s tx_id:%s err:%s", oid, txID, e)
-			// When an error occurs, wait for the callback to fix the txID again
-		}
-	} else {
-		txID = sub.TxID
-		status = sub.Status
-		if status != model.DaoSubscribeSubmit {
-			return
-		}
-		// sub order
-		oid = sub.ID.Hex()
-		notify, _ = pubsub.NewSubscribe(oid)
-	}
-	// wait pay notify
-	select {
-	case <-ctx.Done():
-		err = ctx.Err()
-	case val := <-notify.Ch:
-		status = val.(core.DaoSubscribeT)
-		dao := &model.Dao{
-			ID: daoID,
-		}
-		d, err := ds.GetDao(dao)
-		a, err := ds.GetUserByAddress(d.Address)
-		user, err := ds.GetUserByAddress(address)
-		content := fmt.Sprintf("Subscribe to %s dao successfully, pay %f FavT", d.Name, price)
-		notifyRequest := notify1.PushNotifyRequest{
-			IsSave:    true,
-			NetWorkId: conf.ExternalAppSetting.NetworkID,
-			Region:    conf.ExternalAppSetting.Region,
-			Title:     "Transaction",
-			Content:   content,
-			From:      "transaction",
-			FromType:  model.ORANGE,
-			To:        user.ID.Hex(),
-		}
-		err = notifyGateway.Notify(ctx, notifyRequest)
-		if err != nil {
-			logrus.Errorf("subscription err:%s", err)
-		}
-		content = fmt.Sprintf("%s(%s) subscribed to your dao received %f FavT", user.Nickname, user.Address, price)
-		notifyRequest = notify1.PushNotifyRequest{
-			IsSave:    true,
-			NetWorkId: conf.ExternalAppSetting.NetworkID,
-			Region:    conf.ExternalAppSetting.Region,
-			Title:     "Transaction",
-			Content:   content,
-			From:      "transaction",
-			FromType:  model.ORANGE,
-			To:        a.ID.Hex(),
-		}
-		err = notifyGateway.Notify(ctx, notifyRequest)
-		if err != nil {
-			logrus.Errorf("subscription err:%s", err)
-		}
-	}
-
-	if err == nil {
-		toUser, err := ds.GetUserByAddress(toAddress)
-		if err != nil {
-			logrus.Errorf("get user err:%s", err)
-			return txID, status, err
-		}
-		fromUser, err := ds.GetUserByAddress(address)
-		content := fmt.Sprintf("User %s (%s) subscribed to your dao", fromUser.Nickname, fromUser.Address)
-		notifyRequest := notify1.PushNotifyRequest{
-			IsSave:    false,
-			NetWorkId: conf.ExternalAppSetting.NetworkID,
-			Region:    conf.ExternalAppSetting.Region,
-			Title:     "Subscription",
-			Content:   content,
-			From:      fromUser.ID.Hex(),
-			FromType:  model.USER,
-			To:        toUser.ID.Hex(),
-		}
-		err = notifyGateway.Notify(ctx, notifyRequest)
-		if err != nil {
-			logrus.Errorf("subscription err:%s", err)
-		}
-	}
-	return
-}
+// SubDao is implemented in dao_subscribe.go, as part of the subscribe
+// state machine (Submitted -> Paid -> Activated | Expired | Refunded | Failed).
 
 func UpdateSubscribeDAO(orderID, txID string, status model.DaoSubscribeT) error {
 	return ds.UpdateSubscribeDAO(orderID, txID, status)
 }
 
-func BlockDAO(user *model.User, id primitive.ObjectID) error {
-	_, err := ds.GetDao(&model.Dao{ID: id})
-	if err != nil {
+// BlockDAO records that user has blocked the DAO with the given id. ctx
+// is passed through to the PostBlock insert and cache invalidation so a
+// caller batching several blocks together (BatchBlockDaos) can run them
+// all in the same Mongo session transaction.
+func BlockDAO(ctx context.Context, user *model.User, id primitive.ObjectID) error {
+	if _, err := ds.GetDao(&model.Dao{ID: id}); err != nil {
 		return errcode.NoExistDao
 	}
 	md := model.PostBlock{
@@ -579,20 +477,40 @@ func BlockDAO(user *model.User, id primitive.ObjectID) error {
 		BlockId: id,
 		Model:   model.BlockModelDAO,
 	}
-	err = md.Create(context.Background(), conf.MustMongoDB())
+	err := md.Create(ctx, conf.MustMongoDB())
 	if mongo.IsDuplicateKeyError(err) {
 		return nil
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	if daoCache != nil {
+		if e := daoCache.InvalidateBlockedList(ctx, user.Address); e != nil {
+			logrus.Warnf("service: dao blocked cache invalidate err: %v", e)
+		}
+	}
+	return nil
 }
 
 func GetBlockDaoIDs(user *model.User) []string {
+	ctx := context.TODO()
+	if daoCache != nil {
+		if ids, err := daoCache.GetBlockedDaoIDs(ctx, user.Address); err == nil {
+			return ids
+		}
+	}
 	md := model.PostBlock{}
 	ops := &options.FindOptions{}
 	ops.SetLimit(300)
 	ops.SetSort(bson.M{"created_on": -1})
-	return md.FindIDs(context.TODO(), conf.MustMongoDB(), bson.M{
+	ids := md.FindIDs(ctx, conf.MustMongoDB(), bson.M{
 		"address": user.Address,
 		"model":   model.BlockModelDAO,
 	}, ops)
+	if daoCache != nil {
+		if e := daoCache.SetBlockedDaoIDs(ctx, user.Address, ids, daoBlockedCacheTTL); e != nil {
+			logrus.Warnf("service: dao blocked cache write err: %v", e)
+		}
+	}
+	return ids
 }
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"favor-dao-backend/internal/conf"
+	"favor-dao-backend/internal/core"
+	"favor-dao-backend/internal/events"
+	"favor-dao-backend/internal/model"
+	"favor-dao-backend/pkg/errcode"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// daoCollection is the collection ds itself persists DAO documents to.
+// The batch operations below write to it directly (instead of going
+// through ds.UpdateDao/ds.DeleteDao) so every document in a batch can
+// share a single Mongo session transaction, which ds's own per-call
+// transactions don't give us.
+const daoCollection = "dao"
+
+// BatchResult is the outcome of one DAO in a batch operation - exactly
+// one entry per requested ID, in the same order, so a moderator or
+// migration script can see which IDs failed without the whole batch
+// aborting on the first error.
+type BatchResult struct {
+	DaoID string `json:"dao_id"`
+	Error string `json:"error,omitempty"`
+}
+
+// newBatchResults seeds one successful BatchResult per id, in order, for
+// the batch functions below to fill in errors on as they go.
+func newBatchResults(daoIDs []primitive.ObjectID) []BatchResult {
+	results := make([]BatchResult, len(daoIDs))
+	for i, id := range daoIDs {
+		results[i] = BatchResult{DaoID: id.Hex()}
+	}
+	return results
+}
+
+// isBatchBusinessError reports whether err is a business-rule failure
+// (e.g. errcode.NoExistDao) rather than a Mongo driver/infrastructure
+// error. BatchBlockDaos uses this to fail only the offending ID's own
+// result instead of aborting and rolling back the whole transaction.
+func isBatchBusinessError(err error) bool {
+	_, ok := err.(*errcode.Error)
+	return ok
+}
+
+// noOpChatSync is a ds.UpdateDao callback that stages a DaoUpdated event
+// without asking for a chat group resync. The batch operations below
+// write to daoCollection directly and do not call it.
+func noOpChatSync(ctx context.Context, dao *model.Dao) error {
+	stageDaoEvent(ctx, events.DaoUpdated, dao, map[string]interface{}{"changed_chat": false})
+	return nil
+}
+
+// withDaoTransaction runs fn inside a single Mongo session transaction,
+// committing every write fn made if it returns nil and rolling all of
+// them back if it returns an error.
+func withDaoTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) error) error {
+	sess, err := conf.MustMongoDB().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	_, err = sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+// BatchDeleteDaos deletes every DAO in daoIDs inside a single Mongo
+// transaction - an infrastructure error (a dropped connection, a lost
+// transaction) aborts the whole batch and rolls every delete back, while
+// a per-ID business failure (already gone) only fails that ID's own
+// result - then issues one aggregated search-index delete instead of one
+// per DAO.
+func BatchDeleteDaos(daoIDs []primitive.ObjectID) []BatchResult {
+	results := newBatchResults(daoIDs)
+
+	ctx := context.Background()
+	col := conf.MustMongoDB().Collection(daoCollection)
+	var deleted []string
+	err := withDaoTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		deleted = deleted[:0]
+		for i, id := range daoIDs {
+			res, err := col.DeleteOne(sessCtx, bson.M{"_id": id})
+			if err != nil {
+				return fmt.Errorf("dao %s: %w", id.Hex(), err)
+			}
+			if res.DeletedCount == 0 {
+				results[i].Error = mongo.ErrNoDocuments.Error()
+				continue
+			}
+			deleted = append(deleted, id.Hex())
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("service: batch delete transaction err: %v", err)
+		for i := range results {
+			results[i].Error = err.Error()
+		}
+		return results
+	}
+
+	for _, hex := range deleted {
+		id, _ := primitive.ObjectIDFromHex(hex)
+		bumpDaoCache(ctx, id)
+	}
+	if len(deleted) > 0 {
+		if err := daoSearch.Delete(deleted); err != nil {
+			logrus.Errorf("service: batch delete reindex err: %v", err)
+		}
+	}
+	return results
+}
+
+// BatchSetVisibility sets visibility on every DAO in daoIDs inside a
+// single Mongo transaction, then reindexes the changed DAOs in one Index
+// call instead of one per DAO.
+func BatchSetVisibility(daoIDs []primitive.ObjectID, visibility model.DaoVisibleT) []BatchResult {
+	results := newBatchResults(daoIDs)
+
+	ctx := context.Background()
+	col := conf.MustMongoDB().Collection(daoCollection)
+	var changed []*model.Dao
+	err := withDaoTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		changed = changed[:0]
+		for i, id := range daoIDs {
+			dao := &model.Dao{}
+			if err := col.FindOne(sessCtx, bson.M{"_id": id}).Decode(dao); err != nil {
+				if err == mongo.ErrNoDocuments {
+					results[i].Error = err.Error()
+					continue
+				}
+				return fmt.Errorf("dao %s: %w", id.Hex(), err)
+			}
+			dao.Visibility = visibility
+			if _, err := col.ReplaceOne(sessCtx, bson.M{"_id": id}, dao); err != nil {
+				return fmt.Errorf("dao %s: %w", id.Hex(), err)
+			}
+			changed = append(changed, dao)
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("service: batch set visibility transaction err: %v", err)
+		for i := range results {
+			results[i].Error = err.Error()
+		}
+		return results
+	}
+
+	docs := make(core.DocItems, 0, len(changed))
+	for _, dao := range changed {
+		bumpDaoCache(ctx, dao.ID)
+		docs = append(docs, daoSearchDoc(dao))
+	}
+	if len(docs) > 0 {
+		if _, err := daoSearch.Index(docs); err != nil {
+			logrus.Errorf("service: batch set visibility reindex err: %v", err)
+		}
+	}
+	return results
+}
+
+// BatchBlockDaos blocks every DAO in daoIDs on user's behalf inside a
+// single Mongo transaction - a per-ID business failure (DAO gone) only
+// fails that ID's own result, an already-blocked DAO counts as a
+// success, while a genuine driver
+// error aborts and rolls back every block made so far in the batch.
+func BatchBlockDaos(user *model.User, daoIDs []primitive.ObjectID) []BatchResult {
+	results := newBatchResults(daoIDs)
+
+	ctx := context.Background()
+	err := withDaoTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		for i, id := range daoIDs {
+			if err := BlockDAO(sessCtx, user, id); err != nil {
+				if isBatchBusinessError(err) {
+					results[i].Error = err.Error()
+					continue
+				}
+				return fmt.Errorf("dao %s: %w", id.Hex(), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("service: batch block transaction err: %v", err)
+		for i := range results {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// BatchTransferOwnership reassigns every DAO in daoIDs owned by
+// fromAddress to toAddress inside a single Mongo transaction (a DAO not
+// owned by fromAddress fails its own entry rather than the batch), then
+// reindexes the changed DAOs in one Index call.
+func BatchTransferOwnership(fromAddress, toAddress string, daoIDs []primitive.ObjectID) []BatchResult {
+	results := newBatchResults(daoIDs)
+
+	ctx := context.Background()
+	col := conf.MustMongoDB().Collection(daoCollection)
+	var changed []*model.Dao
+	err := withDaoTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		changed = changed[:0]
+		for i, id := range daoIDs {
+			dao := &model.Dao{}
+			if err := col.FindOne(sessCtx, bson.M{"_id": id}).Decode(dao); err != nil {
+				if err == mongo.ErrNoDocuments {
+					results[i].Error = err.Error()
+					continue
+				}
+				return fmt.Errorf("dao %s: %w", id.Hex(), err)
+			}
+			if dao.Address != fromAddress {
+				results[i].Error = "dao is not owned by fromAddress"
+				continue
+			}
+			dao.Address = toAddress
+			if _, err := col.ReplaceOne(sessCtx, bson.M{"_id": id}, dao); err != nil {
+				return fmt.Errorf("dao %s: %w", id.Hex(), err)
+			}
+			changed = append(changed, dao)
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("service: batch transfer ownership transaction err: %v", err)
+		for i := range results {
+			results[i].Error = err.Error()
+		}
+		return results
+	}
+
+	docs := make(core.DocItems, 0, len(changed))
+	for _, dao := range changed {
+		bumpDaoCache(ctx, dao.ID)
+		docs = append(docs, daoSearchDoc(dao))
+	}
+	if len(docs) > 0 {
+		if _, err := daoSearch.Index(docs); err != nil {
+			logrus.Errorf("service: batch transfer ownership reindex err: %v", err)
+		}
+	}
+	return results
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"favor-dao-backend/pkg/errcode"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewBatchResults(t *testing.T) {
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+
+	results := newBatchResults(ids)
+
+	if len(results) != len(ids) {
+		t.Fatalf("len(results) = %d, want %d", len(results), len(ids))
+	}
+	for i, id := range ids {
+		if results[i].DaoID != id.Hex() {
+			t.Errorf("results[%d].DaoID = %q, want %q", i, results[i].DaoID, id.Hex())
+		}
+		if results[i].Error != "" {
+			t.Errorf("results[%d].Error = %q, want empty", i, results[i].Error)
+		}
+	}
+}
+
+func TestIsBatchBusinessError(t *testing.T) {
+	if !isBatchBusinessError(errcode.NoExistDao) {
+		t.Error("an *errcode.Error must be classified as a business error")
+	}
+	if isBatchBusinessError(errors.New("dropped connection")) {
+		t.Error("a plain driver/infra error must not be classified as a business error")
+	}
+	if isBatchBusinessError(nil) {
+		t.Error("nil must not be classified as a business error")
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"favor-dao-backend/internal/core"
+	"favor-dao-backend/internal/model"
+	"favor-dao-backend/pkg/cache"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/sync/singleflight"
+)
+
+// daoCache fronts the hot DAO reads with Redis; it stays nil (and every
+// cached* helper below falls straight through to Mongo) until
+// InitDaoCache is called.
+var daoCache core.DaoCache
+
+// daoFormattedGroup coalesces concurrent GetDaoFormatted calls for the
+// same (user, dao) pair into a single set of underlying lookups, since a
+// cache miss there fans out to a dao lookup plus two GetPostList calls.
+var daoFormattedGroup singleflight.Group
+
+const (
+	daoCacheTTL          = 5 * time.Minute
+	daoNotFoundTTL       = 30 * time.Second
+	daoNameCacheTTL      = 5 * time.Minute
+	daoFormattedCacheTTL = 2 * time.Minute
+	daoMyListCacheTTL    = 30 * time.Second
+	daoFlagCacheTTL      = time.Minute
+	daoBlockedCacheTTL   = time.Minute
+)
+
+// InitDaoCache wires the Redis-backed DaoCache. Call this once at
+// startup, after conf has been loaded.
+func InitDaoCache(rdb *redis.Client) {
+	daoCache = cache.NewRedisDaoCache(rdb)
+}
+
+// cachedGetDao is GetDao's cache-aside path: check Redis, fall through
+// to Mongo on a miss, and negatively cache a not-found result so repeated
+// lookups of a nonexistent ID don't keep hitting Mongo.
+func cachedGetDao(ctx context.Context, id primitive.ObjectID) (*model.Dao, error) {
+	if daoCache == nil {
+		return ds.GetDao(&model.Dao{ID: id})
+	}
+	dao, err := daoCache.GetDao(ctx, id)
+	switch {
+	case err == nil:
+		return dao, nil
+	case errors.Is(err, core.ErrCachedNotFound):
+		return nil, mongo.ErrNoDocuments
+	case errors.Is(err, core.ErrCacheMiss):
+		// fall through to Mongo below
+	default:
+		logrus.Warnf("service: dao cache read err: %v", err)
+	}
+
+	dao, err = ds.GetDao(&model.Dao{ID: id})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if e := daoCache.SetDaoNotFound(ctx, id, daoNotFoundTTL); e != nil {
+				logrus.Warnf("service: dao cache negative write err: %v", e)
+			}
+		}
+		return nil, err
+	}
+	if e := daoCache.SetDao(ctx, dao, daoCacheTTL); e != nil {
+		logrus.Warnf("service: dao cache write err: %v", e)
+	}
+	return dao, nil
+}
+
+// cachedGetDaoByName is GetDaoByName's cache-aside path: the name->ID
+// mapping is cached on its own TTL and explicitly cleared by
+// invalidateDaoNameCache when UpdateDao commits a rename, then defers to
+// cachedGetDao for the document itself.
+func cachedGetDaoByName(ctx context.Context, name string) (*model.Dao, error) {
+	if daoCache == nil {
+		return ds.GetDaoByName(&model.Dao{Name: name})
+	}
+	id, err := daoCache.GetDaoIDByName(ctx, name)
+	if err == nil {
+		return cachedGetDao(ctx, id)
+	}
+	if !errors.Is(err, core.ErrCacheMiss) {
+		logrus.Warnf("service: dao name cache read err: %v", err)
+	}
+
+	dao, err := ds.GetDaoByName(&model.Dao{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if e := daoCache.SetDaoIDByName(ctx, name, dao.ID, daoNameCacheTTL); e != nil {
+		logrus.Warnf("service: dao name cache write err: %v", e)
+	}
+	if e := daoCache.SetDao(ctx, dao, daoCacheTTL); e != nil {
+		logrus.Warnf("service: dao cache write err: %v", e)
+	}
+	return dao, nil
+}
+
+func cachedCheckSubscribeDAO(ctx context.Context, address string, daoID primitive.ObjectID) bool {
+	if daoCache == nil {
+		return ds.IsSubscribeDAO(address, daoID)
+	}
+	if v, err := daoCache.GetSubscribed(ctx, address, daoID); err == nil {
+		return v
+	}
+	v := ds.IsSubscribeDAO(address, daoID)
+	if err := daoCache.SetSubscribed(ctx, address, daoID, v, daoFlagCacheTTL); err != nil {
+		logrus.Warnf("service: dao subscribed cache write err: %v", err)
+	}
+	return v
+}
+
+func cachedCheckJoinedDAO(ctx context.Context, address string, daoID primitive.ObjectID) bool {
+	if daoCache == nil {
+		return ds.IsJoinedDAO(address, daoID)
+	}
+	if v, err := daoCache.GetJoined(ctx, address, daoID); err == nil {
+		return v
+	}
+	v := ds.IsJoinedDAO(address, daoID)
+	if err := daoCache.SetJoined(ctx, address, daoID, v, daoFlagCacheTTL); err != nil {
+		logrus.Warnf("service: dao joined cache write err: %v", err)
+	}
+	return v
+}
+
+// invalidateDaoNameCache clears the cached name->ID mapping for name,
+// called with a DAO's old name when UpdateDao commits a rename so the
+// freed name can't keep resolving to the renamed-away DAO if another DAO
+// claims it before the mapping's TTL would otherwise expire it.
+func invalidateDaoNameCache(ctx context.Context, name string) {
+	if daoCache == nil {
+		return
+	}
+	if err := daoCache.InvalidateDaoName(ctx, name); err != nil {
+		logrus.Warnf("service: dao name cache invalidate err: %v", err)
+	}
+}
+
+// bumpDaoCache invalidates every GetDao/GetDaoFormatted entry cached for
+// daoID, following an UpdateDao/DeleteDao/SubDao mutation.
+func bumpDaoCache(ctx context.Context, daoID primitive.ObjectID) {
+	if daoCache == nil {
+		return
+	}
+	if err := daoCache.BumpVersion(ctx, daoID); err != nil {
+		logrus.Warnf("service: dao cache bump err: %v", err)
+	}
+}
+
+// invalidateUserDaoCache clears the cached subscribed/joined flags for
+// (address, daoID), used when a mutation changes one of them directly
+// instead of waiting for it to expire.
+func invalidateUserDaoCache(ctx context.Context, address string, daoID primitive.ObjectID) {
+	if daoCache == nil {
+		return
+	}
+	if err := daoCache.InvalidateUser(ctx, address, daoID); err != nil {
+		logrus.Warnf("service: dao user cache invalidate err: %v", err)
+	}
+}
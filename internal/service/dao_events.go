@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"favor-dao-backend/internal/conf"
+	"favor-dao-backend/internal/events"
+	"favor-dao-backend/internal/model"
+	notify1 "favor-dao-backend/pkg/notify"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	eventBus *events.Bus
+	outbox   *events.Outbox
+)
+
+// InitDaoEvents wires the DAO event bus and starts its outbox dispatcher.
+// Search indexing, chat sync, and push notifications run as subscribers
+// instead of being called inline from the mutation that triggered them,
+// so a transient failure in any one of them retries with backoff instead
+// of being logged and dropped. Call this once at startup.
+func InitDaoEvents(db *mongo.Database) {
+	eventBus = events.NewBus()
+	eventBus.Subscribe(events.DaoCreated, subscribeIndexDao)
+	eventBus.Subscribe(events.DaoUpdated, subscribeIndexDao)
+	eventBus.Subscribe(events.DaoUpdated, subscribeSyncChatGroup)
+	eventBus.Subscribe(events.DaoDeleted, subscribeRemoveDaoFromIndex)
+	eventBus.Subscribe(events.DaoSubscribed, subscribeNotifySubscribed)
+	// A bookmark changes dao.FollowCount, which daoSearchDoc embeds as
+	// dao_follow_count - reindex the same way DaoCreated/DaoUpdated do.
+	eventBus.Subscribe(events.DaoBookmarked, subscribeIndexDao)
+
+	outbox = events.NewOutbox(db, eventBus)
+	go outbox.Run(context.Background(), 5*time.Second)
+}
+
+// stageDaoEvent stages evt for the given dao, logging (rather than
+// failing the caller) if the outbox write itself fails - the mutation it
+// describes has already committed, so the event is best-effort from here.
+func stageDaoEvent(ctx context.Context, t events.Type, dao *model.Dao, payload map[string]interface{}) {
+	if outbox == nil {
+		return
+	}
+	evt := &events.Event{Type: t, DaoID: dao.ID, Address: dao.Address, Payload: payload}
+	if err := outbox.Stage(ctx, evt); err != nil {
+		logrus.Errorf("service: stage %s event for dao %s err: %v", t, dao.ID.Hex(), err)
+	}
+}
+
+func subscribeIndexDao(_ context.Context, evt *events.Event) error {
+	dao, err := ds.GetDao(&model.Dao{ID: evt.DaoID})
+	if err != nil {
+		return err
+	}
+	_, err = PushDaoToSearch(dao)
+	return err
+}
+
+func subscribeRemoveDaoFromIndex(_ context.Context, evt *events.Event) error {
+	return DeleteSearchDao(&model.Dao{ID: evt.DaoID})
+}
+
+func subscribeSyncChatGroup(ctx context.Context, evt *events.Event) error {
+	if changed, _ := evt.Payload["changed_chat"].(bool); !changed {
+		return nil
+	}
+	dao, err := ds.GetDao(&model.Dao{ID: evt.DaoID})
+	if err != nil {
+		return err
+	}
+	return UpdateChatGroup(ctx, dao.Address, dao.ID.Hex(), dao.Name, dao.Avatar, dao.Introduction)
+}
+
+func subscribeNotifySubscribed(ctx context.Context, evt *events.Event) error {
+	dao, err := ds.GetDao(&model.Dao{ID: evt.DaoID})
+	if err != nil {
+		return err
+	}
+	subscriber, _ := evt.Payload["subscriber"].(string)
+	fromUser, err := ds.GetUserByAddress(subscriber)
+	if err != nil {
+		return err
+	}
+	toUser, err := ds.GetUserByAddress(evt.Address)
+	if err != nil {
+		return err
+	}
+	price, _ := evt.Payload["price"].(float64)
+
+	content := fmt.Sprintf("Subscribe to %s dao successfully, pay %f FavT", dao.Name, price)
+	if err := notifyGateway.Notify(ctx, notify1.PushNotifyRequest{
+		IsSave:    true,
+		NetWorkId: conf.ExternalAppSetting.NetworkID,
+		Region:    conf.ExternalAppSetting.Region,
+		Title:     "Transaction",
+		Content:   content,
+		From:      "transaction",
+		FromType:  model.ORANGE,
+		To:        fromUser.ID.Hex(),
+	}); err != nil {
+		return err
+	}
+
+	content = fmt.Sprintf("%s(%s) subscribed to your dao received %f FavT", fromUser.Nickname, fromUser.Address, price)
+	if err := notifyGateway.Notify(ctx, notify1.PushNotifyRequest{
+		IsSave:    true,
+		NetWorkId: conf.ExternalAppSetting.NetworkID,
+		Region:    conf.ExternalAppSetting.Region,
+		Title:     "Transaction",
+		Content:   content,
+		From:      "transaction",
+		FromType:  model.ORANGE,
+		To:        toUser.ID.Hex(),
+	}); err != nil {
+		return err
+	}
+
+	content = fmt.Sprintf("User %s (%s) subscribed to your dao", fromUser.Nickname, fromUser.Address)
+	return notifyGateway.Notify(ctx, notify1.PushNotifyRequest{
+		IsSave:    false,
+		NetWorkId: conf.ExternalAppSetting.NetworkID,
+		Region:    conf.ExternalAppSetting.Region,
+		Title:     "Subscription",
+		Content:   content,
+		From:      fromUser.ID.Hex(),
+		FromType:  model.USER,
+		To:        toUser.ID.Hex(),
+	})
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"favor-dao-backend/internal/conf"
+	"favor-dao-backend/internal/core"
+	"favor-dao-backend/internal/model"
+	"favor-dao-backend/pkg/search"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// daoSearch is the active core.DaoSearchService backend. It defaults to
+// legacySearch, which delegates to the `ts` client already used for post
+// search, and is swapped to a dedicated backend by InitDaoSearchBackend.
+var daoSearch core.DaoSearchService = legacySearch{}
+
+// InitDaoSearchBackend switches the DAO search backend to a Zinc/OpenSearch
+// index when cfg.Endpoint is set; otherwise the legacy ts-backed
+// implementation stays in place. Call this once at startup, after conf
+// has been loaded.
+func InitDaoSearchBackend(cfg search.ZincConfig) {
+	if cfg.Endpoint == "" {
+		return
+	}
+	daoSearch = search.NewZincSearch(cfg)
+}
+
+// legacySearch adapts the existing `ts` search client (shared with posts)
+// to core.DaoSearchService, so existing deployments keep working until
+// they're configured to use a dedicated backend.
+type legacySearch struct{}
+
+// Index forwards to ts.AddDocuments one document at a time: ts's API
+// pairs a doc batch with a single id, so indexing more than one DAO per
+// call (as the batch admin endpoints do) would otherwise index every doc
+// past the first under - or conflated with - docs[0]'s id.
+func (legacySearch) Index(docs core.DocItems) (bool, error) {
+	ok := true
+	for _, doc := range docs {
+		id, _ := doc["dao_id"].(string)
+		success, err := ts.AddDocuments(core.DocItems{doc}, id)
+		if err != nil {
+			return false, err
+		}
+		ok = ok && success
+	}
+	return ok, nil
+}
+
+func (legacySearch) Reindex(docs core.DocItems) (bool, error) {
+	return legacySearch{}.Index(docs)
+}
+
+func (legacySearch) Delete(daoIDs []string) error {
+	return ts.DeleteDocuments(daoIDs)
+}
+
+func (legacySearch) Query(core.DaoSearchQuery) (*core.DaoSearchResult, error) {
+	return nil, errors.New("service: DAO search Query requires a Zinc/OpenSearch backend, configure one via InitDaoSearchBackend")
+}
+
+func (legacySearch) Suggest(string, int) ([]core.DaoSuggestion, error) {
+	return nil, errors.New("service: DAO search Suggest requires a Zinc/OpenSearch backend, configure one via InitDaoSearchBackend")
+}
+
+// QueryDaoSearch filters and ranks DAOs via the configured search
+// backend, for the `/dao/search` handler.
+func QueryDaoSearch(q core.DaoSearchQuery) (*core.DaoSearchResult, error) {
+	return daoSearch.Query(q)
+}
+
+// SuggestDaoNames returns the search backend's autocompletion candidates
+// for prefix.
+func SuggestDaoNames(prefix string, limit int) ([]core.DaoSuggestion, error) {
+	return daoSearch.Suggest(prefix, limit)
+}
+
+const daoReindexCheckpointID = "dao_search"
+
+// reindexCheckpoint persists ReindexDaos' paging offset so a restart
+// resumes roughly where the previous run left off instead of starting
+// the whole collection over.
+type reindexCheckpoint struct {
+	ID     string `bson:"_id"`
+	Offset int    `bson:"offset"`
+}
+
+// ReindexDaos rebuilds the DAO search index from Mongo. It pages through
+// DAOs pageSize at a time, indexing each page with up to concurrency
+// workers, and checkpoints its offset after every page so a crash or
+// restart resumes from the last completed page rather than from scratch.
+func ReindexDaos(ctx context.Context, pageSize, concurrency int) error {
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	col := conf.MustMongoDB().Collection("reindex_checkpoints")
+	cp := reindexCheckpoint{ID: daoReindexCheckpointID}
+	_ = col.FindOne(ctx, bson.M{"_id": daoReindexCheckpointID}).Decode(&cp)
+
+	offset := cp.Offset
+	for {
+		daos, err := GetDaoList(&DaoListReq{
+			Conditions: model.ConditionsT{},
+			Offset:     offset,
+			Limit:      pageSize,
+		})
+		if err != nil {
+			return err
+		}
+		if len(daos) == 0 {
+			break
+		}
+
+		if err := indexDaoPage(daos, concurrency); err != nil {
+			return err
+		}
+
+		offset += len(daos)
+		_, err = col.UpdateByID(ctx, daoReindexCheckpointID,
+			bson.M{"$set": bson.M{"offset": offset}},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			logrus.Errorf("dao: reindex checkpoint update err: %v", err)
+		}
+
+		if reindexPassComplete(len(daos), pageSize) {
+			break
+		}
+	}
+
+	// The pass reached the end of the collection rather than stopping on
+	// an error, so reset the checkpoint: otherwise the next ReindexDaos
+	// call resumes from (and finds nothing past) this offset, silently
+	// indexing zero DAOs.
+	_, err := col.UpdateByID(ctx, daoReindexCheckpointID,
+		bson.M{"$set": bson.M{"offset": 0}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		logrus.Errorf("dao: reindex checkpoint reset err: %v", err)
+	}
+	return nil
+}
+
+// reindexPassComplete reports whether the page just processed was the
+// last one in the collection: a short page (fewer rows than requested)
+// means there's nothing left to fetch.
+func reindexPassComplete(fetched, pageSize int) bool {
+	return fetched < pageSize
+}
+
+// indexDaoPage indexes daos with up to concurrency workers, returning the
+// first error encountered (after letting the rest of the page finish).
+func indexDaoPage(daos []*model.Dao, concurrency int) error {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for _, dao := range daos {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(dao *model.Dao) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := PushDaoToSearch(dao); err != nil {
+				logrus.Errorf("dao: reindex dao_id %s err: %v", dao.ID.Hex(), err)
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(dao)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,24 @@
+package service
+
+import "testing"
+
+func TestReindexPassComplete(t *testing.T) {
+	cases := []struct {
+		name    string
+		fetched int
+		page    int
+		want    bool
+	}{
+		{"full page, more to come", 1000, 1000, false},
+		{"short page is the last one", 437, 1000, true},
+		{"empty page is the last one", 0, 1000, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := reindexPassComplete(c.fetched, c.page); got != c.want {
+				t.Errorf("reindexPassComplete(%d, %d) = %v, want %v", c.fetched, c.page, got, c.want)
+			}
+		})
+	}
+}
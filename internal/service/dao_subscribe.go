@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"favor-dao-backend/internal/conf"
+	"favor-dao-backend/internal/core"
+	"favor-dao-backend/internal/events"
+	"favor-dao-backend/internal/model"
+	"favor-dao-backend/pkg/convert"
+	"favor-dao-backend/pkg/pointSystem"
+	"favor-dao-backend/pkg/psub"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PayWaitTimeout bounds how long a Submitted subscribe order is given to
+// receive its pay notification before it's eligible to be expired, either
+// inline by SubDao itself or by the reconciler after a restart. Override
+// at startup if a deployment needs a different window.
+var PayWaitTimeout = 15 * time.Minute
+
+// ErrSubscriptionNotFound is returned by GetSubscriptionStatus and
+// CancelPendingSubscription when orderID has no tracked order.
+var ErrSubscriptionNotFound = errors.New("service: subscription order not found")
+
+// ErrSubscriptionNotPending is returned by CancelPendingSubscription when
+// the order has already left the Submitted state.
+var ErrSubscriptionNotPending = errors.New("service: subscription order is no longer pending")
+
+// pointClient is the subset of point's method set this file depends on -
+// Pay (already relied on before this change) plus the QueryOrder/Refund
+// calls the reconciler and expiry path add. Asserting point against it
+// below pins the exact signatures this file expects, so a mismatch in
+// point's real definition is a compile error here instead of a silent
+// runtime failure.
+type pointClient interface {
+	Pay(ctx context.Context, req pointSystem.PayRequest) (string, error)
+	QueryOrder(ctx context.Context, orderID string) (paid bool, txID string, err error)
+	Refund(ctx context.Context, txID string) error
+}
+
+var _ pointClient = point
+
+// trackSubscribeOrder records the state-machine side of a subscribe
+// order alongside the legacy DaoSubscribe row ds.SubscribeDAO already
+// wrote. It's best-effort: a failure here only costs the new deadline /
+// reconciler / idempotency bookkeeping, not the subscribe itself, so it's
+// logged rather than propagated.
+//
+// Create can collide on IdempotencyKey when another order for this
+// (address, dao) is still in flight (e.g. a concurrent double-click on
+// subscribe - the partial unique index only covers Submitted/Paid
+// orders, see EnsureDaoSubscribeOrderIndexes). On that collision this
+// fetches and returns the real, persisted in-flight order instead of the
+// unpersisted stand-in above: returning the stand-in would leave every
+// later order.UpdateState call filtering on an order_id no document in
+// Mongo actually has, silently losing tracking (and, worse, the refund
+// check in expireSubscribeOrder) for the second caller.
+func trackSubscribeOrder(ctx context.Context, orderID, address string, daoID primitive.ObjectID, price string) *model.DaoSubscribeOrder {
+	key := model.DaoSubscribeIdempotencyKey(address, daoID, "")
+	order := &model.DaoSubscribeOrder{
+		OrderID:        orderID,
+		IdempotencyKey: key,
+		Address:        address,
+		DaoID:          daoID,
+		Price:          price,
+		State:          model.SubscriptionSubmitted,
+		PayDeadline:    time.Now().Add(PayWaitTimeout).Unix(),
+	}
+	db := conf.MustMongoDB()
+	err := order.Create(ctx, db)
+	if err == nil {
+		return order
+	}
+	if !errors.Is(err, model.ErrDuplicateSubscribeOrder) {
+		logrus.Errorf("service: track subscribe order_id:%s err:%v", orderID, err)
+		return order
+	}
+	existing := &model.DaoSubscribeOrder{}
+	if e := existing.FindByIdempotencyKey(ctx, db, key); e != nil {
+		logrus.Errorf("service: track subscribe order_id:%s load in-flight order by key err:%v", orderID, e)
+		return order
+	}
+	return existing
+}
+
+func SubDao(ctx context.Context, daoID primitive.ObjectID, address string) (txID string, status core.DaoSubscribeT, err error) {
+	var (
+		oid    string
+		notify *psub.Notify
+	)
+	defer func() {
+		if notify != nil {
+			notify.Cancel()
+		}
+	}()
+
+	var toAddress string
+	var price float64
+	var order *model.DaoSubscribeOrder
+
+	// check old subscribe
+	sub := model.DaoSubscribe{}
+	err = sub.FindOne(ctx, conf.MustMongoDB(), bson.M{"address": address, "dao_id": daoID})
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return
+	}
+	if err != nil {
+		// ErrNoDocuments
+		// create order
+		err = ds.SubscribeDAO(address, daoID, func(ctx context.Context, orderID string, dao *model.Dao) error {
+			oid = orderID
+			// sub order
+			notify, err = pubsub.NewSubscribe(orderID)
+			if err != nil {
+				return err
+			}
+			toAddress = dao.Address
+			price = convert.StrTo(dao.Price).MustFloat64() / 1000
+			order = trackSubscribeOrder(ctx, orderID, address, daoID, dao.Price)
+			// pay
+			txID, err = point.Pay(ctx, pointSystem.PayRequest{
+				FromObject: address,
+				ToSubject:  toAddress,
+				Amount:     dao.Price,
+				Comment:    "",
+				Channel:    "sub_dao",
+				ReturnURI:  conf.PointSetting.Callback + "/pay/notify?method=sub_dao&order_id=" + orderID,
+				BindOrder:  orderID,
+			})
+			return err
+		})
+		if err != nil {
+			return
+		}
+		e := ds.UpdateSubscribeDAOTxID(oid, txID)
+		if e != nil {
+			logrus.Errorf("ds.UpdateSubscribeDAOTxID order_id:%s tx_id:%s err:%s", oid, txID, e)
+			// When an error occurs, wait for the callback to fix the txID again
+		}
+		if order != nil {
+			// record the initiated tx, state stays Submitted until the
+			// pay callback confirms it below
+			if e := order.UpdateState(ctx, conf.MustMongoDB(), model.SubscriptionSubmitted, txID, model.SubscriptionSubmitted); e != nil {
+				logrus.Errorf("service: record subscribe tx order_id:%s err:%v", oid, e)
+			}
+		}
+	} else {
+		txID = sub.TxID
+		status = sub.Status
+		if status != model.DaoSubscribeSubmit {
+			return
+		}
+		// sub order
+		oid = sub.ID.Hex()
+		notify, _ = pubsub.NewSubscribe(oid)
+		order = &model.DaoSubscribeOrder{OrderID: oid}
+		if e := order.FindByOrderID(ctx, conf.MustMongoDB(), oid); e != nil {
+			// No tracking record yet - either the original
+			// trackSubscribeOrder insert failed, or this row predates
+			// the state machine. Backfill one now instead of leaving
+			// order nil, which would leave deadline a nil channel and
+			// silently revert to the unbounded ctx.Done()-only wait
+			// this type exists to remove.
+			daoPrice := ""
+			if d, e2 := ds.GetDao(&model.Dao{ID: daoID}); e2 == nil {
+				daoPrice = d.Price
+			}
+			order = trackSubscribeOrder(ctx, oid, address, daoID, daoPrice)
+		}
+	}
+
+	// wait pay notify, bounded by the order's pay-wait deadline so a
+	// dropped callback doesn't block the caller forever.
+	var deadline <-chan time.Time
+	if order != nil {
+		deadline = time.After(time.Until(time.Unix(order.PayDeadline, 0)))
+	}
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-deadline:
+		err = expireSubscribeOrder(context.Background(), order)
+	case val := <-notify.Ch:
+		status = val.(core.DaoSubscribeT)
+		dao := &model.Dao{
+			ID: daoID,
+		}
+		d, err := ds.GetDao(dao)
+		if err != nil {
+			return txID, status, err
+		}
+		if order != nil {
+			db := conf.MustMongoDB()
+			if e := order.UpdateState(ctx, db, model.SubscriptionPaid, "", model.SubscriptionSubmitted); e != nil && !errors.Is(e, mongo.ErrNoDocuments) {
+				logrus.Errorf("service: mark paid subscribe order_id:%s err:%v", order.OrderID, e)
+			}
+			if e := order.UpdateState(ctx, db, model.SubscriptionActivated, "", model.SubscriptionPaid); e != nil && !errors.Is(e, mongo.ErrNoDocuments) {
+				logrus.Errorf("service: activate subscribe order_id:%s err:%v", order.OrderID, e)
+			}
+		}
+		stageDaoEvent(ctx, events.DaoSubscribed, d, map[string]interface{}{
+			"price":      price,
+			"subscriber": address,
+		})
+		invalidateUserDaoCache(ctx, address, daoID)
+		bumpDaoCache(ctx, daoID)
+	}
+	return
+}
+
+// expireSubscribeOrder transitions order to Expired and, if it had
+// already been paid (TxID set), issues a point.Refund before marking it
+// Refunded. It's also used by the reconciler, so it only acts on orders
+// still Submitted to avoid racing a pay notification that arrives at the
+// same moment.
+func expireSubscribeOrder(ctx context.Context, order *model.DaoSubscribeOrder) error {
+	if order == nil {
+		return core.ErrSubscriptionExpired
+	}
+	db := conf.MustMongoDB()
+	if err := order.UpdateState(ctx, db, model.SubscriptionExpired, "", model.SubscriptionSubmitted); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// already moved on (paid/cancelled) - nothing to do
+			return core.ErrSubscriptionExpired
+		}
+		logrus.Errorf("service: expire subscribe order_id:%s err:%v", order.OrderID, err)
+		return core.ErrSubscriptionExpired
+	}
+	if order.TxID != "" {
+		if err := point.Refund(ctx, order.TxID); err != nil {
+			logrus.Errorf("service: refund subscribe order_id:%s tx_id:%s err:%v", order.OrderID, order.TxID, err)
+			return core.ErrSubscriptionExpired
+		}
+		if err := order.UpdateState(ctx, db, model.SubscriptionRefunded, "", model.SubscriptionExpired); err != nil {
+			logrus.Errorf("service: mark refunded subscribe order_id:%s err:%v", order.OrderID, err)
+		}
+	}
+	return core.ErrSubscriptionExpired
+}
+
+// GetSubscriptionStatus returns the state-machine status of orderID.
+func GetSubscriptionStatus(orderID string) (*model.DaoSubscribeOrder, error) {
+	order := &model.DaoSubscribeOrder{}
+	if err := order.FindByOrderID(context.TODO(), conf.MustMongoDB(), orderID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return order, nil
+}
+
+// CancelPendingSubscription marks orderID Failed if (and only if) it's
+// still Submitted, so a client can give up on a subscribe it's no longer
+// waiting on. It never calls point.Refund, even when the order already has
+// the TxID of an initiated payment recorded.
+func CancelPendingSubscription(orderID string) error {
+	order := &model.DaoSubscribeOrder{}
+	if err := order.FindByOrderID(context.TODO(), conf.MustMongoDB(), orderID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrSubscriptionNotFound
+		}
+		return err
+	}
+	if err := order.UpdateState(context.TODO(), conf.MustMongoDB(), model.SubscriptionFailed, "", model.SubscriptionSubmitted); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrSubscriptionNotPending
+		}
+		return err
+	}
+	return nil
+}
+
+// InitDaoSubscriptions ensures the subscribe-order indexes exist (most
+// importantly the unique index on idempotency_key, without which
+// duplicate orders are never detected) and starts the background
+// reconciler that expires (and refunds, where applicable) Submitted
+// orders whose pay-wait deadline has passed without a callback -
+// covering the case where SubDao's own caller disconnected or the
+// process restarted before the deadline fired inline. Call this once at
+// startup.
+func InitDaoSubscriptions(pollInterval time.Duration) {
+	if err := model.EnsureDaoSubscribeOrderIndexes(context.Background(), conf.MustMongoDB()); err != nil {
+		logrus.Errorf("service: ensure dao subscribe order indexes err: %v", err)
+	}
+	go reconcileSubscriptionsLoop(context.Background(), pollInterval)
+}
+
+func reconcileSubscriptionsLoop(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ReconcileSubscriptions(ctx)
+		}
+	}
+}
+
+// ReconcileSubscriptions polls point.QueryOrder for every Submitted order
+// whose deadline has passed: an order the payment provider confirms as
+// paid is activated (the client's own wait on notify.Ch may have already
+// given up), everything else is expired and, if it was already charged,
+// refunded.
+func ReconcileSubscriptions(ctx context.Context) {
+	db := conf.MustMongoDB()
+	orders, err := model.FindStuckSubmitted(ctx, db, time.Now(), 100)
+	if err != nil {
+		logrus.Errorf("service: reconcile subscriptions list err: %v", err)
+		return
+	}
+	for _, order := range orders {
+		paid, txID, err := point.QueryOrder(ctx, order.OrderID)
+		if err != nil {
+			logrus.Errorf("service: reconcile subscribe order_id:%s query err: %v", order.OrderID, err)
+			continue
+		}
+		if paid {
+			if err := order.UpdateState(ctx, db, model.SubscriptionPaid, txID, model.SubscriptionSubmitted); err != nil {
+				logrus.Errorf("service: reconcile mark paid order_id:%s err: %v", order.OrderID, err)
+				continue
+			}
+			if err := order.UpdateState(ctx, db, model.SubscriptionActivated, "", model.SubscriptionPaid); err != nil {
+				logrus.Errorf("service: reconcile activate order_id:%s err: %v", order.OrderID, err)
+				continue
+			}
+			bumpDaoCache(ctx, order.DaoID)
+			dao, err := ds.GetDao(&model.Dao{ID: order.DaoID})
+			if err != nil {
+				logrus.Errorf("service: reconcile activate order_id:%s load dao err: %v", order.OrderID, err)
+				continue
+			}
+			price := convert.StrTo(order.Price).MustFloat64() / 1000
+			stageDaoEvent(ctx, events.DaoSubscribed, dao, map[string]interface{}{
+				"price":      price,
+				"subscriber": order.Address,
+			})
+			invalidateUserDaoCache(ctx, order.Address, order.DaoID)
+			continue
+		}
+		if txID != "" {
+			order.TxID = txID
+		}
+		_ = expireSubscribeOrder(ctx, order)
+	}
+}
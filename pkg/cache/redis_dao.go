@@ -0,0 +1,276 @@
+// Package cache provides core.DaoCache backends.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"favor-dao-backend/internal/core"
+	"favor-dao-backend/internal/model"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// notFoundSentinel is stored instead of a DAO document to negatively
+// cache a lookup that's already known to miss in Mongo.
+const notFoundSentinel = "\x00notfound"
+
+// RedisDaoCache is a core.DaoCache backed by Redis. Every DAO-scoped key
+// is namespaced by a per-DAO version counter (dao:v{n}:{id}), so
+// BumpVersion invalidates GetDao/GetDaoFormatted for that DAO in one
+// atomic INCR instead of deleting each key individually.
+type RedisDaoCache struct {
+	rdb *redis.Client
+}
+
+// NewRedisDaoCache returns a RedisDaoCache using rdb.
+func NewRedisDaoCache(rdb *redis.Client) *RedisDaoCache {
+	return &RedisDaoCache{rdb: rdb}
+}
+
+// versionOnMiss is what version() returns for a daoID with no counter
+// key yet. It must equal what Redis INCR does to a missing key (0->1),
+// not the value BumpVersion is meant to move callers away from: a fresh
+// DAO's reads are cached at this version, so its first BumpVersion has
+// to land one past it, or that first bump invalidates nothing.
+const versionOnMiss int64 = 0
+
+// version returns the current version for daoID.
+func (c *RedisDaoCache) version(ctx context.Context, daoID primitive.ObjectID) (int64, error) {
+	v, err := c.rdb.Get(ctx, "dao:ver:"+daoID.Hex()).Int64()
+	if err == redis.Nil {
+		return versionOnMiss, nil
+	}
+	return v, err
+}
+
+func daoKeyForVersion(v int64, daoID primitive.ObjectID) string {
+	return fmt.Sprintf("dao:v%d:%s", v, daoID.Hex())
+}
+
+func formattedKeyForVersion(v int64, user string, daoID primitive.ObjectID) string {
+	return fmt.Sprintf("dao:v%d:%s:fmt:%s", v, daoID.Hex(), user)
+}
+
+func (c *RedisDaoCache) daoKey(ctx context.Context, daoID primitive.ObjectID) (string, error) {
+	v, err := c.version(ctx, daoID)
+	if err != nil {
+		return "", err
+	}
+	return daoKeyForVersion(v, daoID), nil
+}
+
+func (c *RedisDaoCache) formattedKey(ctx context.Context, user string, daoID primitive.ObjectID) (string, error) {
+	v, err := c.version(ctx, daoID)
+	if err != nil {
+		return "", err
+	}
+	return formattedKeyForVersion(v, user, daoID), nil
+}
+
+// GetDao implements core.DaoCache.
+func (c *RedisDaoCache) GetDao(ctx context.Context, daoID primitive.ObjectID) (*model.Dao, error) {
+	key, err := c.daoKey(ctx, daoID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, core.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	if string(raw) == notFoundSentinel {
+		return nil, core.ErrCachedNotFound
+	}
+	dao := &model.Dao{}
+	if err := json.Unmarshal(raw, dao); err != nil {
+		return nil, err
+	}
+	return dao, nil
+}
+
+// SetDao implements core.DaoCache.
+func (c *RedisDaoCache) SetDao(ctx context.Context, dao *model.Dao, ttl time.Duration) error {
+	key, err := c.daoKey(ctx, dao.ID)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(dao)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, key, raw, ttl).Err()
+}
+
+// SetDaoNotFound implements core.DaoCache.
+func (c *RedisDaoCache) SetDaoNotFound(ctx context.Context, daoID primitive.ObjectID, ttl time.Duration) error {
+	key, err := c.daoKey(ctx, daoID)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, key, notFoundSentinel, ttl).Err()
+}
+
+// GetDaoIDByName implements core.DaoCache.
+func (c *RedisDaoCache) GetDaoIDByName(ctx context.Context, name string) (primitive.ObjectID, error) {
+	hex, err := c.rdb.Get(ctx, "dao:name:"+name).Result()
+	if err == redis.Nil {
+		return primitive.NilObjectID, core.ErrCacheMiss
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return primitive.ObjectIDFromHex(hex)
+}
+
+// SetDaoIDByName implements core.DaoCache.
+func (c *RedisDaoCache) SetDaoIDByName(ctx context.Context, name string, daoID primitive.ObjectID, ttl time.Duration) error {
+	return c.rdb.Set(ctx, "dao:name:"+name, daoID.Hex(), ttl).Err()
+}
+
+// InvalidateDaoName implements core.DaoCache.
+func (c *RedisDaoCache) InvalidateDaoName(ctx context.Context, name string) error {
+	return c.rdb.Del(ctx, "dao:name:"+name).Err()
+}
+
+// GetDaoFormatted implements core.DaoCache.
+func (c *RedisDaoCache) GetDaoFormatted(ctx context.Context, user string, daoID primitive.ObjectID) (*model.DaoFormatted, error) {
+	key, err := c.formattedKey(ctx, user, daoID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, core.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := &model.DaoFormatted{}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetDaoFormatted implements core.DaoCache.
+func (c *RedisDaoCache) SetDaoFormatted(ctx context.Context, user string, daoID primitive.ObjectID, out *model.DaoFormatted, ttl time.Duration) error {
+	key, err := c.formattedKey(ctx, user, daoID)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, key, raw, ttl).Err()
+}
+
+// GetMyDaoList implements core.DaoCache.
+func (c *RedisDaoCache) GetMyDaoList(ctx context.Context, address string) ([]*model.DaoFormatted, error) {
+	raw, err := c.rdb.Get(ctx, "dao:mylist:"+address).Bytes()
+	if err == redis.Nil {
+		return nil, core.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*model.DaoFormatted
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// SetMyDaoList implements core.DaoCache.
+func (c *RedisDaoCache) SetMyDaoList(ctx context.Context, address string, list []*model.DaoFormatted, ttl time.Duration) error {
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, "dao:mylist:"+address, raw, ttl).Err()
+}
+
+func (c *RedisDaoCache) GetSubscribed(ctx context.Context, address string, daoID primitive.ObjectID) (bool, error) {
+	return c.getFlag(ctx, "dao:sub:"+address+":"+daoID.Hex())
+}
+
+func (c *RedisDaoCache) SetSubscribed(ctx context.Context, address string, daoID primitive.ObjectID, subscribed bool, ttl time.Duration) error {
+	return c.setFlag(ctx, "dao:sub:"+address+":"+daoID.Hex(), subscribed, ttl)
+}
+
+func (c *RedisDaoCache) GetJoined(ctx context.Context, address string, daoID primitive.ObjectID) (bool, error) {
+	return c.getFlag(ctx, "dao:joined:"+address+":"+daoID.Hex())
+}
+
+func (c *RedisDaoCache) SetJoined(ctx context.Context, address string, daoID primitive.ObjectID, joined bool, ttl time.Duration) error {
+	return c.setFlag(ctx, "dao:joined:"+address+":"+daoID.Hex(), joined, ttl)
+}
+
+func (c *RedisDaoCache) getFlag(ctx context.Context, key string) (bool, error) {
+	v, err := c.rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return false, core.ErrCacheMiss
+	}
+	if err != nil {
+		return false, err
+	}
+	return v == "1", nil
+}
+
+func (c *RedisDaoCache) setFlag(ctx context.Context, key string, val bool, ttl time.Duration) error {
+	v := "0"
+	if val {
+		v = "1"
+	}
+	return c.rdb.Set(ctx, key, v, ttl).Err()
+}
+
+// GetBlockedDaoIDs implements core.DaoCache.
+func (c *RedisDaoCache) GetBlockedDaoIDs(ctx context.Context, address string) ([]string, error) {
+	raw, err := c.rdb.Get(ctx, "dao:blocked:"+address).Bytes()
+	if err == redis.Nil {
+		return nil, core.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := json.Unmarshal(raw, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SetBlockedDaoIDs implements core.DaoCache.
+func (c *RedisDaoCache) SetBlockedDaoIDs(ctx context.Context, address string, ids []string, ttl time.Duration) error {
+	raw, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, "dao:blocked:"+address, raw, ttl).Err()
+}
+
+// InvalidateBlockedList implements core.DaoCache.
+func (c *RedisDaoCache) InvalidateBlockedList(ctx context.Context, address string) error {
+	return c.rdb.Del(ctx, "dao:blocked:"+address).Err()
+}
+
+// BumpVersion implements core.DaoCache. It increments the DAO's version
+// counter so every dao:v{n}:{id}* key built against the old version is
+// simply never looked up again; Redis reclaims them on their own TTL.
+func (c *RedisDaoCache) BumpVersion(ctx context.Context, daoID primitive.ObjectID) error {
+	return c.rdb.Incr(ctx, "dao:ver:"+daoID.Hex()).Err()
+}
+
+// InvalidateUser implements core.DaoCache.
+func (c *RedisDaoCache) InvalidateUser(ctx context.Context, address string, daoID primitive.ObjectID) error {
+	return c.rdb.Del(ctx,
+		"dao:sub:"+address+":"+daoID.Hex(),
+		"dao:joined:"+address+":"+daoID.Hex(),
+	).Err()
+}
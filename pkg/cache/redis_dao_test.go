@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestVersionOnMissSurvivesFirstBump guards the off-by-one this file
+// used to have: version() returned 1 for a missing counter, the same
+// value Redis INCR produces on that counter's *first* real increment
+// (INCR goes 0->1), so the first BumpVersion after a DAO's reads were
+// cached landed callers back on the exact key they already had cached -
+// invalidating nothing.
+func TestVersionOnMissSurvivesFirstBump(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	cachedAt := daoKeyForVersion(versionOnMiss, id)
+	// INCR on a missing counter key always yields 1.
+	afterFirstBump := daoKeyForVersion(1, id)
+
+	if cachedAt == afterFirstBump {
+		t.Fatalf("first BumpVersion must move callers off the key cached at versionOnMiss, got %q both times", cachedAt)
+	}
+}
+
+func TestFormattedKeyForVersionVariesByUserAndDao(t *testing.T) {
+	idA := primitive.NewObjectID()
+	idB := primitive.NewObjectID()
+
+	if formattedKeyForVersion(1, "alice", idA) == formattedKeyForVersion(1, "bob", idA) {
+		t.Fatal("formatted key must differ by user")
+	}
+	if formattedKeyForVersion(1, "alice", idA) == formattedKeyForVersion(1, "alice", idB) {
+		t.Fatal("formatted key must differ by dao")
+	}
+}
@@ -0,0 +1,284 @@
+// Package search provides core.DaoSearchService backends.
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"favor-dao-backend/internal/core"
+)
+
+// ZincConfig configures a Zinc/OpenSearch-compatible backend. Endpoint
+// should point at the node's base URL (e.g. "http://localhost:4080");
+// Zinc and OpenSearch both expose a `/_bulk` NDJSON endpoint and a
+// `/{index}/_search` query endpoint under that scheme.
+type ZincConfig struct {
+	Endpoint  string
+	Index     string
+	Username  string
+	Password  string
+	BatchSize int
+	Timeout   time.Duration
+}
+
+// ZincSearch is a core.DaoSearchService backed by a Zinc or
+// OpenSearch-compatible HTTP index.
+type ZincSearch struct {
+	cfg    ZincConfig
+	client *http.Client
+}
+
+// NewZincSearch returns a ZincSearch using cfg, filling in a default
+// batch size and timeout when left unset.
+func NewZincSearch(cfg ZincConfig) *ZincSearch {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &ZincSearch{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Index bulk-uploads docs to the index via `/_bulk`, batching at
+// cfg.BatchSize documents per request.
+func (z *ZincSearch) Index(docs core.DocItems) (bool, error) {
+	for start := 0; start < len(docs); start += z.cfg.BatchSize {
+		end := start + z.cfg.BatchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+		if err := z.bulkUpsert(docs[start:end]); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Reindex is Index under another name: the Zinc bulk API upserts by ID,
+// so a full reindex is just re-uploading every document.
+func (z *ZincSearch) Reindex(docs core.DocItems) (bool, error) {
+	return z.Index(docs)
+}
+
+func (z *ZincSearch) bulkUpsert(docs core.DocItems) error {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		id, _ := doc["dao_id"].(string)
+		action := map[string]interface{}{
+			"index": map[string]interface{}{"_index": z.cfg.Index, "_id": id},
+		}
+		if err := json.NewEncoder(&body).Encode(action); err != nil {
+			return err
+		}
+		if err := json.NewEncoder(&body).Encode(doc); err != nil {
+			return err
+		}
+	}
+	resp, err := z.doRequest(http.MethodPost, "/_bulk", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("search: zinc bulk upsert failed with status %s", resp.Status)
+	}
+	return nil
+}
+
+// Delete removes daoIDs from the index via one `/_bulk` request.
+func (z *ZincSearch) Delete(daoIDs []string) error {
+	if len(daoIDs) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	for _, id := range daoIDs {
+		action := map[string]interface{}{
+			"delete": map[string]interface{}{"_index": z.cfg.Index, "_id": id},
+		}
+		if err := json.NewEncoder(&body).Encode(action); err != nil {
+			return err
+		}
+	}
+	resp, err := z.doRequest(http.MethodPost, "/_bulk", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("search: zinc bulk delete failed with status %s", resp.Status)
+	}
+	return nil
+}
+
+// zincQuery is the subset of the Zinc/OpenSearch query DSL this backend
+// builds for DAO search and suggest.
+type zincQuery struct {
+	Query struct {
+		Bool struct {
+			Must   []map[string]interface{} `json:"must,omitempty"`
+			Filter []map[string]interface{} `json:"filter,omitempty"`
+		} `json:"bool"`
+	} `json:"query"`
+	From int `json:"from"`
+	Size int `json:"size"`
+}
+
+// Query runs q against the index, applying keyword, tag, visibility,
+// follow-count, and created-on filters.
+func (z *ZincSearch) Query(q core.DaoSearchQuery) (*core.DaoSearchResult, error) {
+	zq := zincQuery{From: q.Offset, Size: q.Limit}
+	if zq.Size <= 0 {
+		zq.Size = 20
+	}
+	if q.Keyword != "" {
+		zq.Query.Bool.Must = append(zq.Query.Bool.Must, map[string]interface{}{
+			"match": map[string]interface{}{"content": q.Keyword},
+		})
+	}
+	for _, tag := range q.Tags {
+		zq.Query.Bool.Filter = append(zq.Query.Bool.Filter, map[string]interface{}{
+			"term": map[string]interface{}{"tags": tag},
+		})
+	}
+	if len(q.Visibility) > 0 {
+		zq.Query.Bool.Filter = append(zq.Query.Bool.Filter, map[string]interface{}{
+			"terms": map[string]interface{}{"visibility": q.Visibility},
+		})
+	}
+	if q.MinFollow > 0 || q.MaxFollow > 0 {
+		rng := map[string]interface{}{}
+		if q.MinFollow > 0 {
+			rng["gte"] = q.MinFollow
+		}
+		if q.MaxFollow > 0 {
+			rng["lte"] = q.MaxFollow
+		}
+		zq.Query.Bool.Filter = append(zq.Query.Bool.Filter, map[string]interface{}{
+			"range": map[string]interface{}{"dao_follow_count": rng},
+		})
+	}
+	if !q.CreatedFrom.IsZero() || !q.CreatedTo.IsZero() {
+		rng := map[string]interface{}{}
+		if !q.CreatedFrom.IsZero() {
+			rng["gte"] = q.CreatedFrom.Unix()
+		}
+		if !q.CreatedTo.IsZero() {
+			rng["lte"] = q.CreatedTo.Unix()
+		}
+		zq.Query.Bool.Filter = append(zq.Query.Bool.Filter, map[string]interface{}{
+			"range": map[string]interface{}{"created_on": rng},
+		})
+	}
+
+	var payload bytes.Buffer
+	if err := json.NewEncoder(&payload).Encode(zq); err != nil {
+		return nil, err
+	}
+	resp, err := z.doRequest(http.MethodPost, "/"+z.cfg.Index+"/_search", &payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("search: zinc query failed with status %s", resp.Status)
+	}
+
+	var parsed struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID     string                 `json:"_id"`
+				Score  float64                `json:"_score"`
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	result := &core.DaoSearchResult{Total: parsed.Hits.Total.Value}
+	for _, h := range parsed.Hits.Hits {
+		hit := core.DaoSearchHit{DaoID: h.ID, Score: h.Score}
+		if fc, ok := h.Source["dao_follow_count"].(float64); ok {
+			hit.FollowCount = int64(fc)
+		}
+		if co, ok := h.Source["created_on"].(float64); ok {
+			hit.CreatedOn = int64(co)
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, nil
+}
+
+// Suggest returns DAO name autocompletion candidates for prefix using a
+// match_phrase_prefix query over the indexed content field (name and
+// introduction); each candidate is the name line of a hit. Tags are not
+// searched or returned.
+func (z *ZincSearch) Suggest(prefix string, limit int) ([]core.DaoSuggestion, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	payload := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match_phrase_prefix": map[string]interface{}{"content": prefix},
+		},
+		"size": limit,
+	}
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(payload); err != nil {
+		return nil, err
+	}
+	resp, err := z.doRequest(http.MethodPost, "/"+z.cfg.Index+"/_search", &body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("search: zinc suggest failed with status %s", resp.Status)
+	}
+
+	var parsed struct {
+		Hits struct {
+			Hits []struct {
+				Score  float64                `json:"_score"`
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]core.DaoSuggestion, 0, len(parsed.Hits.Hits))
+	for _, h := range parsed.Hits.Hits {
+		name, _ := h.Source["content"].(string)
+		suggestions = append(suggestions, core.DaoSuggestion{
+			Text:  strings.SplitN(name, "\n", 2)[0],
+			Score: h.Score,
+		})
+	}
+	return suggestions, nil
+}
+
+func (z *ZincSearch) doRequest(method, path string, body *bytes.Buffer) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(z.cfg.Endpoint, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if z.cfg.Username != "" {
+		req.SetBasicAuth(z.cfg.Username, z.cfg.Password)
+	}
+	return z.client.Do(req)
+}